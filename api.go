@@ -18,6 +18,7 @@ type B2 struct {
 	APIURL             string
 	DownloadURL        string
 	client             client
+	buckets            *bucketCache
 }
 
 // The client interface is satisfied by an http.Client and a testClient.
@@ -53,6 +54,7 @@ func CreateB2(accountID, appKey string) (*B2, error) {
 		AccountID:      accountID,
 		ApplicationKey: appKey,
 		client:         http.DefaultClient,
+		buckets:        newBucketCache(),
 	}
 	return b2.createB2()
 }
@@ -94,12 +96,15 @@ func CreateRequest(method, url string, request interface{}) (*http.Request, erro
 
 // GetBzInfoHeaders returns a map of headers in a response that start with
 // "X-Bz-Info-", which are file metadata that were uploaded with the file.
+//
+// B2 stores file info names in lowercase, so the names are lowercased to undo
+// the canonicalization of header keys. The values are percent-decoded.
 func GetBzInfoHeaders(resp *http.Response) map[string]string {
 	out := map[string]string{}
 	for k, v := range resp.Header {
 		if strings.HasPrefix(k, "X-Bz-Info-") {
 			// strip Bz prefix and grab first header
-			out[k[10:]] = v[0]
+			out[strings.ToLower(k[10:])] = decodeHeader(v[0])
 		}
 	}
 	return out
@@ -94,16 +94,17 @@ func TestCreateRequest(t *testing.T) {
 
 func TestGetBzInfoHeaders(t *testing.T) {
 	headers := map[string][]string{
-		"Content-Type":      {"kittens"},
-		"X-Bz-Info-kittens": {"yes"},
-		"X-Bz-Info-thing":   {"one"},
+		"Content-Type":                       {"kittens"},
+		"X-Bz-Info-kittens":                  {"yes"},
+		"X-Bz-Info-thing":                    {"one"},
+		"X-Bz-Info-Src_last_modified_millis": {"1"},
 	}
 	resp := &http.Response{Header: headers}
 
 	bzHeaders := GetBzInfoHeaders(resp)
 
-	if len(bzHeaders) != 2 {
-		t.Fatalf("Expected length of headers to be 2, instead got %d", len(bzHeaders))
+	if len(bzHeaders) != 3 {
+		t.Fatalf("Expected length of headers to be 3, instead got %d", len(bzHeaders))
 	}
 	if h, ok := bzHeaders["Content-Type"]; ok {
 		t.Errorf("Expected no Content-Type, instead recieved %s", h)
@@ -114,6 +115,10 @@ func TestGetBzInfoHeaders(t *testing.T) {
 	if h := bzHeaders["thing"]; h != "one" {
 		t.Errorf(`Expected thing to be "one", instead got %s`, h)
 	}
+	// canonicalized header names are lowercased
+	if h := bzHeaders["src_last_modified_millis"]; h != "1" {
+		t.Errorf(`Expected src_last_modified_millis to be "1", instead got %s`, h)
+	}
 }
 
 type testClient struct {
@@ -125,6 +130,32 @@ func (dc *testClient) Do(r *http.Request) (*http.Response, error) {
 	return testResponse(400, `{"status":400,"code":"nope","message":"nope nope"}`), nil
 }
 
+// replayClient returns its Responses in order, recording every Request.
+// Once the Responses run out it returns the same error as testClient.
+type replayClient struct {
+	Requests  []*http.Request
+	Responses []*http.Response
+}
+
+func (rc *replayClient) Do(r *http.Request) (*http.Response, error) {
+	rc.Requests = append(rc.Requests, r)
+	if len(rc.Responses) == 0 {
+		return testResponse(400, `{"status":400,"code":"nope","message":"nope nope"}`), nil
+	}
+	resp := rc.Responses[0]
+	rc.Responses = rc.Responses[1:]
+	return resp, nil
+}
+
+// paths returns the URL path of every recorded request.
+func (rc *replayClient) paths() []string {
+	out := []string{}
+	for _, r := range rc.Requests {
+		out = append(out, r.URL.Path)
+	}
+	return out
+}
+
 func testB2() *B2 {
 	return &B2{
 		AccountID:          "id",
@@ -132,6 +163,7 @@ func testB2() *B2 {
 		APIURL:             "https://api900.backblaze.com",
 		DownloadURL:        "https://f900.backblaze.com",
 		client:             &testClient{},
+		buckets:            newBucketCache(),
 	}
 }
 
@@ -1,18 +1,27 @@
 package b2
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
 // Bucket contains all data about a B2 Bucket. It also has a reference to
 // the B2 account which it is under.
 type Bucket struct {
-	ID         string       `json:"bucketId"`
-	Name       string       `json:"bucketName"`
-	Type       BucketType   `json:"bucketType"`
-	UploadURLs []*UploadURL `json:"-"`
-	B2         *B2          `json:"-"`
+	ID                string                 `json:"bucketId"`
+	Name              string                 `json:"bucketName"`
+	Type              BucketType             `json:"bucketType"`
+	LifecycleRules    []LifecycleRule        `json:"lifecycleRules"`
+	CORSRules         []CORSRule             `json:"corsRules"`
+	Info              map[string]string      `json:"bucketInfo"`
+	Revision          int64                  `json:"revision"`
+	DefaultEncryption *BucketEncryption      `json:"defaultServerSideEncryption"`
+	FileLock          *FileLockConfiguration `json:"fileLockConfiguration"`
+	UploadURLs        []*UploadURL           `json:"-"`
+	B2                *B2                    `json:"-"`
 }
 
 // BucketType is the visibility of a bucket.
@@ -24,6 +33,44 @@ const (
 	AllPublic  BucketType = "allPublic"
 )
 
+// BucketOptions are the optional settings of a bucket, used when creating or
+// updating it. Fields left as nil are not sent, and are unchanged on update.
+type BucketOptions struct {
+	// LifecycleRules replace all of the bucket's rules. A non-nil empty
+	// slice removes every rule.
+	LifecycleRules []LifecycleRule
+
+	// CORSRules replace all of the bucket's CORS rules. A non-nil empty
+	// slice removes every rule.
+	CORSRules []CORSRule
+
+	// Info replaces all of the bucket's info. A non-nil empty map removes
+	// every key.
+	Info map[string]string
+
+	// IfRevisionIs makes an update fail with ErrRevisionConflict unless the
+	// bucket is still at this revision. Zero skips the check, and it is
+	// ignored when creating a bucket.
+	IfRevisionIs int64
+
+	// DefaultEncryption is applied to files uploaded without their own
+	// encryption. Only SSE-B2 may be a default, and an Encryption with no
+	// Mode turns default encryption off.
+	DefaultEncryption *Encryption
+
+	// FileLockEnabled turns on file lock, which allows files to have
+	// retention and legal holds. It can only be set when creating a bucket.
+	FileLockEnabled bool
+
+	// DefaultRetention is applied to files uploaded without their own
+	// retention. The bucket must have file lock enabled.
+	DefaultRetention *DefaultRetention
+}
+
+// ErrRevisionConflict is returned when a bucket update is made with
+// IfRevisionIs, and the bucket has changed since that revision.
+var ErrRevisionConflict = errors.New("Bucket revision has changed")
+
 // UploadURL is a special URL used for upolading files to a bucket. It has
 // its own separate Authorization Token, and expires 24 hours after creation.
 type UploadURL struct {
@@ -40,17 +87,168 @@ type listBucketsResponse struct {
 // bucketRequest is used for making any bucket related request.
 // The accountID is always required, though the other parameters vary.
 type bucketRequest struct {
-	AccountID  string     `json:"accountId"`
-	BucketID   string     `json:"bucketId,omitempty"`
-	BucketName string     `json:"bucketName,omitempty"`
-	BucketType BucketType `json:"bucketType,omitempty"`
+	AccountID                   string             `json:"accountId"`
+	BucketID                    string             `json:"bucketId,omitempty"`
+	BucketName                  string             `json:"bucketName,omitempty"`
+	BucketType                  BucketType         `json:"bucketType,omitempty"`
+	LifecycleRules              *[]LifecycleRule   `json:"lifecycleRules,omitempty"`
+	CORSRules                   *[]CORSRule        `json:"corsRules,omitempty"`
+	BucketInfo                  *map[string]string `json:"bucketInfo,omitempty"`
+	IfRevisionIs                int64              `json:"ifRevisionIs,omitempty"`
+	DefaultServerSideEncryption *Encryption        `json:"defaultServerSideEncryption,omitempty"`
+	FileLockEnabled             bool               `json:"fileLockEnabled,omitempty"`
+	DefaultRetention            *DefaultRetention  `json:"defaultRetention,omitempty"`
+}
+
+// setOptions copies any set BucketOptions into the bucketRequest.
+func (br *bucketRequest) setOptions(opts *BucketOptions) {
+	if opts == nil {
+		return
+	}
+	if opts.LifecycleRules != nil {
+		br.LifecycleRules = &opts.LifecycleRules
+	}
+	if opts.CORSRules != nil {
+		br.CORSRules = &opts.CORSRules
+	}
+	if opts.Info != nil {
+		br.BucketInfo = &opts.Info
+	}
+	br.DefaultServerSideEncryption = opts.DefaultEncryption.withDefaults()
+	br.DefaultRetention = opts.DefaultRetention
+}
+
+// validate checks BucketOptions for anything B2 would reject.
+func (opts *BucketOptions) validate() error {
+	if opts == nil {
+		return nil
+	}
+	if len(opts.Info) > 10 {
+		return fmt.Errorf("More than 10 bucket info keys provided")
+	}
+	if e := opts.DefaultEncryption; e != nil && e.Mode != EncryptionNone && e.Mode != EncryptionSSEB2 {
+		return fmt.Errorf("Default bucket encryption must be SSE-B2 or none")
+	}
+	if err := opts.DefaultEncryption.validate(); err != nil {
+		return err
+	}
+	if err := opts.DefaultRetention.validate(); err != nil {
+		return err
+	}
+	if err := ValidateLifecycleRules(opts.LifecycleRules); err != nil {
+		return err
+	}
+	return ValidateCORSRules(opts.CORSRules)
+}
+
+// bucketCache holds Bucket handles that have been looked up by name or ID,
+// keyed by bucket ID.
+//
+// A nil bucketCache is valid and caches nothing.
+type bucketCache struct {
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+func newBucketCache() *bucketCache {
+	return &bucketCache{buckets: map[string]*Bucket{}}
+}
+
+// find returns the first cached Bucket that match accepts, or nil.
+func (c *bucketCache) find(match func(*Bucket) bool) *Bucket {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range c.buckets {
+		if match(b) {
+			return b
+		}
+	}
+	return nil
+}
+
+func (c *bucketCache) put(b *Bucket) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buckets[b.ID] = b
+}
+
+func (c *bucketCache) remove(id string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.buckets, id)
 }
 
 // ListBuckets gets a list of all buckets in an account.
 //
 // It also sets up the necessary reference to the B2 API client.
 func (b2 *B2) ListBuckets() ([]Bucket, error) {
-	req, err := b2.createBucketRequest("/b2api/v1/b2_list_buckets", bucketRequest{})
+	return b2.listBuckets(bucketRequest{})
+}
+
+// BucketByName returns the bucket with the given name.
+//
+// Buckets are looked up with a filtered list request, and the returned
+// handle is cached on the B2 client, so later lookups make no request.
+func (b2 *B2) BucketByName(name string) (*Bucket, error) {
+	if name == "" {
+		return nil, fmt.Errorf("No bucket name provided")
+	}
+	if b := b2.buckets.find(func(b *Bucket) bool { return b.Name == name }); b != nil {
+		return b, nil
+	}
+	return b2.lookupBucket(bucketRequest{BucketName: name}, name)
+}
+
+// BucketByID returns the bucket with the given ID.
+//
+// Buckets are looked up with a filtered list request, and the returned
+// handle is cached on the B2 client, so later lookups make no request.
+func (b2 *B2) BucketByID(id string) (*Bucket, error) {
+	if id == "" {
+		return nil, fmt.Errorf("No bucket ID provided")
+	}
+	if b := b2.buckets.find(func(b *Bucket) bool { return b.ID == id }); b != nil {
+		return b, nil
+	}
+	return b2.lookupBucket(bucketRequest{BucketID: id}, id)
+}
+
+// BucketHandle makes a Bucket without contacting B2.
+//
+// It is meant for application keys that are restricted to a bucket and may
+// not be allowed to list buckets. The type must be correct for downloads from
+// private buckets to be authorized.
+func (b2 *B2) BucketHandle(id, name string, t BucketType) *Bucket {
+	return &Bucket{ID: id, Name: name, Type: t, B2: b2}
+}
+
+// lookupBucket makes a filtered list request for a single bucket and caches
+// the result.
+func (b2 *B2) lookupBucket(br bucketRequest, key string) (*Bucket, error) {
+	buckets, err := b2.listBuckets(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("Bucket %s not found", key)
+	}
+	b := &buckets[0]
+	b2.buckets.put(b)
+	return b, nil
+}
+
+// listBuckets lists the buckets matching the bucketRequest's filters.
+func (b2 *B2) listBuckets(br bucketRequest) ([]Bucket, error) {
+	req, err := b2.createBucketRequest("/b2api/v1/b2_list_buckets", br)
 	if err != nil {
 		return nil, err
 	}
@@ -77,8 +275,27 @@ func (b2 *B2) parseListBuckets(resp *http.Response) ([]Bucket, error) {
 
 // CreateBucket creates a new bucket with the given name and type.
 func (b2 *B2) CreateBucket(name string, t BucketType) (*Bucket, error) {
+	return b2.CreateBucketWithOptions(name, t, nil)
+}
+
+// CreateBucketWithOptions creates a new bucket with the given name, type,
+// and optional settings.
+//
+// The options are validated before the request is made. B2 only accepts a
+// default retention on update, so one is set with a second request after the
+// bucket is created. If that request fails, the created bucket is returned
+// along with the error.
+func (b2 *B2) CreateBucketWithOptions(name string, t BucketType, opts *BucketOptions) (*Bucket, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 	br := bucketRequest{BucketName: name, BucketType: t}
-	req, err := b2.createBucketRequest("/b2api/v1/b2_list_buckets", br)
+	br.setOptions(opts)
+	br.DefaultRetention = nil
+	if opts != nil {
+		br.FileLockEnabled = opts.FileLockEnabled
+	}
+	req, err := b2.createBucketRequest("/b2api/v1/b2_create_bucket", br)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +304,11 @@ func (b2 *B2) CreateBucket(name string, t BucketType) (*Bucket, error) {
 	if err != nil {
 		return nil, err
 	}
-	return b2.parseCreateBucket(resp)
+	b, err := b2.parseCreateBucket(resp)
+	if err != nil || opts == nil || opts.DefaultRetention == nil {
+		return b, err
+	}
+	return b, b.UpdateWithOptions("", &BucketOptions{DefaultRetention: opts.DefaultRetention})
 }
 
 func (b2 *B2) parseCreateBucket(resp *http.Response) (*Bucket, error) {
@@ -103,7 +324,22 @@ func (b2 *B2) parseCreateBucket(resp *http.Response) (*Bucket, error) {
 //
 // The type is modified in place if successful, and unchanged otherwise.
 func (b *Bucket) Update(newBucketType BucketType) error {
+	return b.UpdateWithOptions(newBucketType, nil)
+}
+
+// UpdateWithOptions sets the bucket type and any provided options on a
+// bucket. An empty type leaves the type unchanged.
+//
+// The bucket is modified in place if successful, and unchanged otherwise.
+func (b *Bucket) UpdateWithOptions(newBucketType BucketType, opts *BucketOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
 	br := bucketRequest{BucketID: b.ID, BucketType: newBucketType}
+	br.setOptions(opts)
+	if opts != nil {
+		br.IfRevisionIs = opts.IfRevisionIs
+	}
 	req, err := b.B2.createBucketRequest("/b2api/v1/b2_update_bucket", br)
 	if err != nil {
 		return err
@@ -113,11 +349,28 @@ func (b *Bucket) Update(newBucketType BucketType) error {
 	if err != nil {
 		return err
 	}
+	b.B2.buckets.remove(b.ID)
 	return b.parseUpdate(resp)
 }
 
+// parseUpdate modifies the bucket in place. A conflict response, which B2
+// only sends when ifRevisionIs doesn't match, becomes ErrRevisionConflict.
+//
+// The response is parsed into a fresh Bucket so that removed info keys and
+// rules don't linger.
 func (b *Bucket) parseUpdate(resp *http.Response) error {
-	return parseResponse(resp, b)
+	updated := Bucket{}
+	err := parseResponse(resp, &updated)
+	if e, ok := err.(*APIError); ok && e.Status == http.StatusConflict {
+		return ErrRevisionConflict
+	}
+	if err != nil {
+		return err
+	}
+	updated.UploadURLs = b.UploadURLs
+	updated.B2 = b.B2
+	*b = updated
+	return nil
 }
 
 // Delete removes a bucket. The bucket reference itself is unchanged.
@@ -132,6 +385,7 @@ func (b *Bucket) Delete() error {
 	if err != nil {
 		return err
 	}
+	b.B2.buckets.remove(b.ID)
 	return b.parseDelete(resp)
 }
 
@@ -2,6 +2,7 @@ package b2
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"testing"
 )
@@ -50,6 +51,85 @@ func TestB2_parseListBuckets(t *testing.T) {
 	}
 }
 
+func TestB2_BucketByName(t *testing.T) {
+	b2 := testB2()
+	rc := testReplayClient(
+		`{"buckets":[{"bucketId":"id","bucketName":"name","bucketType":"allPrivate"}]}`,
+		`{"bucketId":"id","bucketName":"name","bucketType":"allPublic"}`,
+		`{"buckets":[{"bucketId":"id","bucketName":"name","bucketType":"allPublic"}]}`,
+	)
+	b2.client = rc
+
+	bucket, err := b2.BucketByName("name")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if bucket.ID != "id" || bucket.B2 != b2 {
+		t.Errorf("Expected bucket id with B2 set, instead got %+v", bucket)
+	}
+	body, _ := ioutil.ReadAll(rc.Requests[0].Body)
+	if !bytes.Contains(body, []byte(`"bucketName":"name"`)) {
+		t.Errorf("Expected list to be filtered by name, instead got %s", body)
+	}
+
+	// cached, by name and by ID
+	if b, _ := b2.BucketByName("name"); b != bucket {
+		t.Errorf("Expected the cached bucket, instead got %+v", b)
+	}
+	if b, _ := b2.BucketByID("id"); b != bucket {
+		t.Errorf("Expected the cached bucket, instead got %+v", b)
+	}
+	if len(rc.Requests) != 1 {
+		t.Errorf("Expected one request, instead got %d", len(rc.Requests))
+	}
+
+	// updates invalidate the cache
+	if err := bucket.Update(AllPublic); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	bucket, err = b2.BucketByName("name")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if bucket.Type != AllPublic {
+		t.Errorf("Expected a fresh bucket, instead got %+v", bucket)
+	}
+	checkPaths(rc, []string{"b2_list_buckets", "b2_update_bucket", "b2_list_buckets"}, t)
+}
+
+func TestB2_BucketByID(t *testing.T) {
+	b2 := testB2()
+	rc := testReplayClient(`{"buckets":[]}`)
+	b2.client = rc
+
+	bucket, err := b2.BucketByID("missing")
+	if err == nil {
+		t.Error("Expected a missing bucket to be an error")
+	}
+	if bucket != nil {
+		t.Errorf("Expected bucket to be nil, instead got %+v", bucket)
+	}
+	body, _ := ioutil.ReadAll(rc.Requests[0].Body)
+	if !bytes.Contains(body, []byte(`"bucketId":"missing"`)) {
+		t.Errorf("Expected list to be filtered by ID, instead got %s", body)
+	}
+
+	if _, err := b2.BucketByID(""); err == nil {
+		t.Error("Expected an empty ID to be an error")
+	}
+}
+
+func TestB2_BucketHandle(t *testing.T) {
+	b2 := testB2()
+	bucket := b2.BucketHandle("id", "name", AllPrivate)
+	if bucket.ID != "id" || bucket.Name != "name" || bucket.Type != AllPrivate || bucket.B2 != b2 {
+		t.Errorf("Expected a bucket handle, instead got %+v", bucket)
+	}
+	if b2.client.(*testClient).Request != nil {
+		t.Error("Expected no request to be made")
+	}
+}
+
 func TestB2_CreateBucket(t *testing.T) {
 	b2 := testB2()
 	b2.CreateBucket("name", AllPrivate)
@@ -60,6 +140,32 @@ func TestB2_CreateBucket(t *testing.T) {
 	}
 }
 
+func TestB2_CreateBucketWithOptions(t *testing.T) {
+	b2 := testB2()
+	bad := &BucketOptions{LifecycleRules: []LifecycleRule{{FileNamePrefix: "a"}}}
+	bucket, err := b2.CreateBucketWithOptions("name", AllPrivate, bad)
+	if err == nil {
+		t.Error("Expected invalid options to fail")
+	}
+	if bucket != nil {
+		t.Errorf("Expected bucket to be nil, instead got %+v", bucket)
+	}
+	if b2.client.(*testClient).Request != nil {
+		t.Error("Expected no request to be made with invalid options")
+	}
+
+	opts := &BucketOptions{LifecycleRules: []LifecycleRule{{FileNamePrefix: "a", DaysFromHidingToDeleting: 1}}}
+	b2.CreateBucketWithOptions("name", AllPrivate, opts)
+	req := b2.client.(*testClient).Request
+	if req.URL.Path != "/b2api/v1/b2_create_bucket" {
+		t.Errorf("Expected path to be b2_create_bucket, instead got %s", req.URL.Path)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if !bytes.Contains(body, []byte(`"lifecycleRules":[{"fileNamePrefix":"a","daysFromHidingToDeleting":1}]`)) {
+		t.Errorf("Expected lifecycleRules in body, instead got %s", body)
+	}
+}
+
 func TestB2_parseCreateBucket(t *testing.T) {
 	resp := testResponse(200, `{"bucketId":"id","accountId":"id","bucketName":"bucket","bucketType":"allPrivate"}`)
 	b2 := &B2{}
@@ -101,8 +207,27 @@ func TestBucket_Update(t *testing.T) {
 	}
 }
 
+func TestBucket_UpdateWithOptions(t *testing.T) {
+	bucket := testBucket()
+	bucket.UpdateWithOptions("", nil)
+	req := bucket.B2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	if bytes.Contains(body, []byte("lifecycleRules")) || bytes.Contains(body, []byte("bucketType")) {
+		t.Errorf("Expected unset options to be left out, instead got %s", body)
+	}
+
+	// an empty, non-nil slice clears all rules
+	bucket.UpdateWithOptions("", &BucketOptions{LifecycleRules: []LifecycleRule{}})
+	req = bucket.B2.client.(*testClient).Request
+	body, _ = ioutil.ReadAll(req.Body)
+	if !bytes.Contains(body, []byte(`"lifecycleRules":[]`)) {
+		t.Errorf("Expected empty lifecycleRules, instead got %s", body)
+	}
+}
+
 func TestBucket_parseUpdate(t *testing.T) {
-	resp := testResponse(200, `{"bucketId":"id","accountId":"id","bucketName":"bucket","bucketType":"allPublic"}`)
+	resp := testResponse(200, `{"bucketId":"id","accountId":"id","bucketName":"bucket","bucketType":"allPublic",`+
+		`"lifecycleRules":[{"fileNamePrefix":"logs/","daysFromHidingToDeleting":7,"daysFromUploadingToHiding":null}]}`)
 	bucket := testBucket()
 	err := bucket.parseUpdate(resp)
 	if err != nil {
@@ -113,6 +238,9 @@ func TestBucket_parseUpdate(t *testing.T) {
 	if bucket.Type != AllPublic {
 		t.Errorf("Expected bucket type to be private, instead got %s", bucket.Type)
 	}
+	if len(bucket.LifecycleRules) != 1 || bucket.LifecycleRules[0].DaysFromHidingToDeleting != 7 {
+		t.Errorf("Expected one lifecycle rule, instead got %+v", bucket.LifecycleRules)
+	}
 
 	// nothing else should have changed
 	if bucket.ID != "id" {
@@ -133,6 +261,55 @@ func TestBucket_parseUpdate(t *testing.T) {
 	}
 }
 
+func TestBucket_parseUpdate_info(t *testing.T) {
+	bucket := testBucket()
+	bucket.Info = map[string]string{"old": "1", "kept": "1"}
+	bucket.Revision = 1
+	resp := testResponse(200, `{"bucketId":"id","bucketName":"bucket","bucketType":"allPrivate",`+
+		`"bucketInfo":{"kept":"2"},"revision":2}`)
+	if err := bucket.parseUpdate(resp); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(bucket.Info) != 1 || bucket.Info["kept"] != "2" {
+		t.Errorf(`Expected info to only have "kept", instead got %+v`, bucket.Info)
+	}
+	if bucket.Revision != 2 {
+		t.Errorf("Expected revision to be 2, instead got %d", bucket.Revision)
+	}
+	if bucket.B2 == nil {
+		t.Error("Expected bucket B2 to be kept")
+	}
+
+	resp = testResponse(409, `{"status":409,"code":"conflict","message":"revision mismatch"}`)
+	if err := bucket.parseUpdate(resp); err != ErrRevisionConflict {
+		t.Errorf("Expected ErrRevisionConflict, instead got %v", err)
+	}
+	if bucket.Revision != 2 {
+		t.Errorf("Expected revision to be unchanged, instead got %d", bucket.Revision)
+	}
+}
+
+func TestBucket_UpdateWithOptions_revision(t *testing.T) {
+	bucket := testBucket()
+	opts := &BucketOptions{Info: map[string]string{"owner": "ops"}, IfRevisionIs: 3}
+	bucket.UpdateWithOptions("", opts)
+	req := bucket.B2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	for _, field := range []string{`"bucketInfo":{"owner":"ops"}`, `"ifRevisionIs":3`} {
+		if !bytes.Contains(body, []byte(field)) {
+			t.Errorf("Expected %s in body, instead got %s", field, body)
+		}
+	}
+
+	info := map[string]string{}
+	for i := 0; i < 11; i++ {
+		info[fmt.Sprintf("%d", i)] = ""
+	}
+	if err := bucket.UpdateWithOptions("", &BucketOptions{Info: info}); err == nil {
+		t.Error("Expected more than 10 info keys to fail")
+	}
+}
+
 func TestBucket_Delete(t *testing.T) {
 	bucket := testBucket()
 	bucket.Delete()
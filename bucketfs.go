@@ -0,0 +1,268 @@
+package b2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BucketFS is a read-only fs.FS over the current files in a Bucket.
+//
+// File names are split on "/" into virtual directories, which are found by
+// listing with a prefix and delimiter. Files are downloaded in full the first
+// time they are read.
+type BucketFS struct {
+	Bucket *Bucket
+}
+
+// FS returns an fs.FS of the bucket's files, which also implements
+// fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+func (b *Bucket) FS() *BucketFS {
+	return &BucketFS{Bucket: b}
+}
+
+// Open opens a file or directory.
+func (bfs *BucketFS) Open(name string) (fs.File, error) {
+	info, err := bfs.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &bucketDir{fs: bfs, name: name, info: info}, nil
+	}
+	return &bucketFile{fs: bfs, info: info}, nil
+}
+
+// Stat returns the FileInfo of a file or directory without downloading it.
+func (bfs *BucketFS) Stat(name string) (fs.FileInfo, error) {
+	return bfs.stat("stat", name)
+}
+
+// ReadFile downloads a file.
+func (bfs *BucketFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := bfs.Bucket.DownloadFileByName(name)
+	if err != nil {
+		return nil, fsError("readfile", name, err)
+	}
+	return f.Data, nil
+}
+
+// ReadDir lists a directory, sorted by name.
+func (bfs *BucketFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	prefix := dirPrefix(name)
+	entries := []fs.DirEntry{}
+	next := ""
+	for {
+		lfr, err := bfs.Bucket.ListFileNamesWithPrefix(prefix, "/", next, 1000)
+		if err != nil {
+			return nil, fsError("readdir", name, err)
+		}
+		for _, f := range lfr.Files {
+			base := strings.TrimSuffix(strings.TrimPrefix(f.Name, prefix), "/")
+			if base == "" {
+				// a file named like the directory itself, such as "dir/"
+				continue
+			}
+			entries = append(entries, fs.FileInfoToDirEntry(newBucketFileInfo(base, f)))
+		}
+		if lfr.NextFileName == "" {
+			break
+		}
+		next = lfr.NextFileName
+	}
+
+	if len(entries) == 0 && name != "." {
+		info, err := bfs.stat("readdir", name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("not a directory")}
+		}
+	}
+
+	// B2 sorts "dir/" after "dir-file", but without the slash it comes first
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// stat finds a name as a file, or failing that as a directory.
+func (bfs *BucketFS) stat(op, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return newBucketFileInfo(".", FileMeta{Action: ActionFolder}), nil
+	}
+
+	lfr, err := bfs.Bucket.ListFileNamesWithPrefix(name, "/", name, 1)
+	if err != nil {
+		return nil, fsError(op, name, err)
+	}
+	if len(lfr.Files) == 1 {
+		f := lfr.Files[0]
+		if f.Name == name || f.Name == name+"/" {
+			return newBucketFileInfo(path.Base(name), f), nil
+		}
+	}
+
+	// a directory sorts after a file of the same name, so look again
+	lfr, err = bfs.Bucket.ListFileNamesWithPrefix(name+"/", "/", "", 1)
+	if err != nil {
+		return nil, fsError(op, name, err)
+	}
+	if len(lfr.Files) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return newBucketFileInfo(path.Base(name), FileMeta{Name: name + "/", Action: ActionFolder}), nil
+}
+
+// dirPrefix is the listing prefix of the files within a directory.
+func dirPrefix(name string) string {
+	if name == "." {
+		return ""
+	}
+	return name + "/"
+}
+
+// fsError turns a B2 "not found" error into fs.ErrNotExist.
+func fsError(op, name string, err error) error {
+	if e, ok := err.(*APIError); ok && e.Status == 404 {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// bucketFileInfo is an fs.FileInfo backed by FileMeta.
+type bucketFileInfo struct {
+	name string
+	meta FileMeta
+}
+
+func newBucketFileInfo(name string, meta FileMeta) *bucketFileInfo {
+	return &bucketFileInfo{name: name, meta: meta}
+}
+
+func (fi *bucketFileInfo) Name() string     { return fi.name }
+func (fi *bucketFileInfo) Size() int64      { return fi.meta.ContentLength }
+func (fi *bucketFileInfo) IsDir() bool      { return fi.meta.Action == ActionFolder }
+func (fi *bucketFileInfo) Sys() interface{} { return &fi.meta }
+
+func (fi *bucketFileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime is the file's src_last_modified_millis if it was uploaded with
+// one, and its upload time otherwise.
+func (fi *bucketFileInfo) ModTime() time.Time {
+	millis := fi.meta.UploadTimestamp
+	if m, ok := srcLastModified(&fi.meta); ok {
+		millis = m
+	}
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
+// bucketFile is an open file. Its data is downloaded on the first read.
+type bucketFile struct {
+	fs     *BucketFS
+	info   fs.FileInfo
+	reader *bytes.Reader
+}
+
+func (f *bucketFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *bucketFile) Close() error               { return nil }
+
+func (f *bucketFile) load() error {
+	if f.reader != nil {
+		return nil
+	}
+	meta := f.info.Sys().(*FileMeta)
+	data, err := f.fs.Bucket.DownloadFileByID(meta.ID)
+	if err != nil {
+		return fsError("read", meta.Name, err)
+	}
+	f.reader = bytes.NewReader(data.Data)
+	return nil
+}
+
+func (f *bucketFile) Read(p []byte) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Read(p)
+}
+
+// Seek allows a bucketFile to be served by http.FileServer.
+func (f *bucketFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *bucketFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.load(); err != nil {
+		return 0, err
+	}
+	return f.reader.ReadAt(p, off)
+}
+
+// bucketDir is an open directory. Its entries are listed on the first call
+// to ReadDir.
+type bucketDir struct {
+	fs      *BucketFS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *bucketDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *bucketDir) Close() error               { return nil }
+
+func (d *bucketDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *bucketDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+
+	if n <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
@@ -0,0 +1,95 @@
+package b2
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestBucketFS(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "index.html", []byte("<h1>cats</h1>"), nil)
+	fake.put("id", "img/cat.jpg", []byte("meow"), nil)
+	fake.put("id", "img/kittens/small.jpg", []byte("mew"), nil)
+	fake.put("id", "img-old.jpg", []byte("old"), nil)
+	fake.put("id", "notes.txt", []byte("notes"), map[string]string{"src_last_modified_millis": "1500000000000"})
+
+	err := fstest.TestFS(bucket.FS(), "index.html", "img/cat.jpg", "img/kittens/small.jpg", "img-old.jpg", "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBucketFS_Stat(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "notes.txt", []byte("notes"), map[string]string{"src_last_modified_millis": "1500000000000"})
+	fake.put("id", "dir/file", []byte("x"), nil)
+	bfs := bucket.FS()
+
+	info, err := bfs.Stat("notes.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if info.IsDir() || info.Size() != 5 || info.Name() != "notes.txt" {
+		t.Errorf("Expected a 5 byte file, instead got %+v", info)
+	}
+	if !info.ModTime().Equal(time.Unix(1500000000, 0)) {
+		t.Errorf("Expected mod time from src_last_modified_millis, instead got %s", info.ModTime())
+	}
+
+	info, err = bfs.Stat("dir")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !info.IsDir() || info.Name() != "dir" {
+		t.Errorf("Expected a directory, instead got %+v", info)
+	}
+
+	for _, name := range []string{"missing", "di", "dir/missing"} {
+		if _, err := bfs.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Expected %s not to exist, instead got %v", name, err)
+		}
+	}
+	if _, err := bfs.Stat("/notes.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Expected a rooted path to be invalid, instead got %v", err)
+	}
+	if _, err := bfs.ReadFile("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ReadFile of a missing file to not exist, instead got %v", err)
+	}
+	if _, err := bfs.ReadDir("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected ReadDir of a missing directory to not exist, instead got %v", err)
+	}
+	if entries, err := bfs.ReadDir("notes.txt"); err == nil {
+		t.Errorf("Expected ReadDir of a file to fail, instead got %v", entries)
+	}
+}
+
+func TestBucketFS_WalkDir(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	for _, name := range []string{"a/1", "a/b/2", "c"} {
+		fake.put("id", name, []byte(name), nil)
+	}
+
+	walked := []string{}
+	err := fs.WalkDir(bucket.FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	expected := []string{".", "a", "a/1", "a/b", "a/b/2", "c"}
+	if len(walked) != len(expected) {
+		t.Fatalf("Expected %v, instead got %v", expected, walked)
+	}
+	for i := range expected {
+		if walked[i] != expected[i] {
+			t.Errorf("Expected %s, instead got %s", expected[i], walked[i])
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ifo/b2"
+)
+
+func (a *app) authorize(args []string) error {
+	fs := a.flags("authorize")
+	if err := parse(fs, args, 0, 2); err != nil {
+		return err
+	}
+	acct := account{AccountID: a.getenv("B2_ACCOUNT_ID"), ApplicationKey: a.getenv("B2_APPLICATION_KEY")}
+	switch fs.NArg() {
+	case 2:
+		acct = account{AccountID: fs.Arg(0), ApplicationKey: fs.Arg(1)}
+	case 1:
+		return usageError("Expected both an account ID and an application key")
+	}
+	if acct.AccountID == "" || acct.ApplicationKey == "" {
+		return usageError("No credentials: pass them as arguments, or set B2_ACCOUNT_ID and B2_APPLICATION_KEY")
+	}
+
+	client, err := b2.CreateB2(acct.AccountID, acct.ApplicationKey)
+	if err != nil {
+		return err
+	}
+	p, err := a.saveCredentials(acct)
+	if err != nil {
+		return err
+	}
+	out := struct {
+		AccountID   string `json:"accountId"`
+		APIURL      string `json:"apiUrl"`
+		DownloadURL string `json:"downloadUrl"`
+		AccountFile string `json:"accountFile"`
+	}{client.AccountID, client.APIURL, client.DownloadURL, p}
+	return a.print(out, func(w io.Writer) {
+		fmt.Fprintf(w, "Authorized account %s, saved to %s\n", out.AccountID, out.AccountFile)
+	})
+}
+
+func (a *app) listBuckets(args []string) error {
+	fs := a.flags("list-buckets")
+	if err := parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	buckets, err := client.ListBuckets()
+	if err != nil {
+		return err
+	}
+	return a.print(buckets, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, b := range buckets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", b.ID, b.Type, b.Name)
+		}
+		tw.Flush()
+	})
+}
+
+func (a *app) createBucket(args []string) error {
+	fs := a.flags("create-bucket")
+	bucketType := fs.String("type", string(b2.AllPrivate), "allPrivate or allPublic")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	t, err := parseBucketType(*bucketType)
+	if err != nil {
+		return err
+	}
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	bucket, err := client.CreateBucket(fs.Arg(0), t)
+	if err != nil {
+		return err
+	}
+	return a.print(bucket, func(w io.Writer) {
+		fmt.Fprintln(w, bucket.ID)
+	})
+}
+
+func (a *app) updateBucket(args []string) error {
+	fs := a.flags("update-bucket")
+	bucketType := fs.String("type", "", "allPrivate or allPublic")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	t, err := parseBucketType(*bucketType)
+	if err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := bucket.Update(t); err != nil {
+		return err
+	}
+	return a.print(bucket, func(w io.Writer) {
+		fmt.Fprintf(w, "%s is now %s\n", bucket.Name, bucket.Type)
+	})
+}
+
+func (a *app) deleteBucket(args []string) error {
+	fs := a.flags("delete-bucket")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := bucket.Delete(); err != nil {
+		return err
+	}
+	return a.print(bucket, func(w io.Writer) {
+		fmt.Fprintf(w, "Deleted %s\n", bucket.Name)
+	})
+}
+
+func (a *app) ls(args []string) error {
+	fs := a.flags("ls")
+	versions := fs.Bool("versions", false, "list every version, including hidden files")
+	recursive := fs.Bool("recursive", false, "list the files within folders")
+	if err := parse(fs, args, 1, 2); err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	prefix := fs.Arg(1)
+	var files []b2.FileMeta
+	if *versions {
+		files, err = listVersions(bucket, prefix, *recursive)
+	} else {
+		files, err = listNames(bucket, prefix, *recursive)
+	}
+	if err != nil {
+		return err
+	}
+	return a.print(files, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, f := range files {
+			if f.Action == b2.ActionFolder {
+				fmt.Fprintf(tw, "\t\t\t\t%s\n", f.Name)
+				continue
+			}
+			uploaded := time.Unix(0, f.UploadTimestamp*int64(time.Millisecond)).UTC().Format("2006-01-02 15:04:05")
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", f.ID, f.Action, uploaded, f.ContentLength, f.Name)
+		}
+		tw.Flush()
+	})
+}
+
+// listNames lists the current files starting with prefix. Unless recursive,
+// files within folders are listed as their folder.
+func listNames(bucket *b2.Bucket, prefix string, recursive bool) ([]b2.FileMeta, error) {
+	delimiter := "/"
+	if recursive {
+		delimiter = ""
+	}
+	files := []b2.FileMeta{}
+	next := ""
+	for {
+		lfr, err := bucket.ListFileNamesWithPrefix(prefix, delimiter, next, 1000)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, lfr.Files...)
+		if lfr.NextFileName == "" {
+			return files, nil
+		}
+		next = lfr.NextFileName
+	}
+}
+
+// listVersions lists every version of the files starting with prefix. Unless
+// recursive, files within folders are listed as their folder.
+func listVersions(bucket *b2.Bucket, prefix string, recursive bool) ([]b2.FileMeta, error) {
+	files := []b2.FileMeta{}
+	folders := map[string]bool{}
+	nextName, nextID := prefix, ""
+	for {
+		lfr, err := bucket.ListFileVersions(nextName, nextID, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range lfr.Files {
+			if !strings.HasPrefix(f.Name, prefix) {
+				return files, nil
+			}
+			if i := strings.Index(f.Name[len(prefix):], "/"); i >= 0 && !recursive {
+				folder := f.Name[:len(prefix)+i+1]
+				if !folders[folder] {
+					folders[folder] = true
+					files = append(files, b2.FileMeta{Name: folder, Action: b2.ActionFolder})
+				}
+				continue
+			}
+			files = append(files, f)
+		}
+		if lfr.NextFileName == "" {
+			return files, nil
+		}
+		nextName, nextID = lfr.NextFileName, lfr.NextFileID
+	}
+}
+
+func (a *app) upload(args []string) error {
+	fs := a.flags("upload")
+	contentType := fs.String("content-type", "", "the file's MIME type, which B2 picks by default")
+	info := infoFlag{}
+	fs.Var(info, "info", "a key=value file info pair, which may be repeated")
+	if err := parse(fs, args, 3, 3); err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	meta, err := bucket.UploadLocalFile(fs.Arg(1), fs.Arg(2), &b2.UploadOptions{FileInfo: info, ContentType: *contentType})
+	if err != nil {
+		return err
+	}
+	return a.print(meta, func(w io.Writer) {
+		fmt.Fprintf(w, "Uploaded %s as %s\n", meta.Name, meta.ID)
+	})
+}
+
+func (a *app) download(args []string) error {
+	fs := a.flags("download")
+	byID := fs.Bool("id", false, "download a file version by ID rather than by name")
+	if err := parse(fs, args, 3, 3); err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dest := fs.Arg(2)
+	opts := &b2.LocalDownloadOptions{RestoreModTime: true}
+	var meta *b2.FileMeta
+	if *byID {
+		meta, err = bucket.DownloadLocalFileByID(fs.Arg(1), dest, opts)
+	} else {
+		meta, err = bucket.DownloadLocalFile(fs.Arg(1), dest, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return a.print(meta, func(w io.Writer) {
+		fmt.Fprintf(w, "Downloaded %s to %s (%d bytes)\n", meta.Name, dest, meta.ContentLength)
+	})
+}
+
+func (a *app) hide(args []string) error {
+	fs := a.flags("hide")
+	if err := parse(fs, args, 2, 2); err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	meta, err := bucket.HideFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	return a.print(meta, func(w io.Writer) {
+		fmt.Fprintf(w, "Hid %s\n", meta.Name)
+	})
+}
+
+func (a *app) rm(args []string) error {
+	fs := a.flags("rm")
+	fileID := fs.String("id", "", "the version to delete, rather than the newest")
+	all := fs.Bool("all-versions", false, "delete every version of the file")
+	if err := parse(fs, args, 2, 2); err != nil {
+		return err
+	}
+	if *fileID != "" && *all {
+		return usageError("--id and --all-versions can't both be used")
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	name := fs.Arg(1)
+	var deleteIDs []string
+	if *fileID != "" {
+		deleteIDs = []string{*fileID}
+	} else {
+		versions, err := bucket.FileVersions(name)
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			deleteIDs = append(deleteIDs, v.ID)
+		}
+		if len(deleteIDs) == 0 {
+			return fmt.Errorf("File %s not found", name)
+		}
+		if !*all {
+			deleteIDs = deleteIDs[:1]
+		}
+	}
+
+	deleted := []b2.FileMeta{}
+	for _, id := range deleteIDs {
+		meta, err := bucket.DeleteFileVersion(name, id)
+		if err != nil {
+			return err
+		}
+		deleted = append(deleted, *meta)
+	}
+	return a.print(deleted, func(w io.Writer) {
+		for _, d := range deleted {
+			fmt.Fprintf(w, "Deleted %s (%s)\n", d.Name, d.ID)
+		}
+	})
+}
+
+func (a *app) getFileInfo(args []string) error {
+	fs := a.flags("get-file-info")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	client, err := a.client()
+	if err != nil {
+		return err
+	}
+	// getting file info by ID doesn't need the file's bucket
+	meta, err := client.BucketHandle("", "", b2.AllPrivate).GetFileInfo(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return a.print(meta, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "fileId\t%s\n", meta.ID)
+		fmt.Fprintf(tw, "fileName\t%s\n", meta.Name)
+		fmt.Fprintf(tw, "contentLength\t%d\n", meta.ContentLength)
+		fmt.Fprintf(tw, "contentSha1\t%s\n", meta.ContentSha1)
+		fmt.Fprintf(tw, "contentType\t%s\n", meta.ContentType)
+		fmt.Fprintf(tw, "uploadTimestamp\t%d\n", meta.UploadTimestamp)
+		for k, v := range meta.FileInfo {
+			fmt.Fprintf(tw, "info %s\t%s\n", k, v)
+		}
+		tw.Flush()
+	})
+}
+
+func (a *app) getUploadURL(args []string) error {
+	fs := a.flags("get-upload-url")
+	if err := parse(fs, args, 1, 1); err != nil {
+		return err
+	}
+	bucket, err := a.bucket(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	u, err := bucket.GetUploadURL()
+	if err != nil {
+		return err
+	}
+	return a.print(u, func(w io.Writer) {
+		fmt.Fprintf(w, "%s\n%s\n", u.URL, u.AuthorizationToken)
+	})
+}
+
+// parseBucketType checks a bucket type given as a flag.
+func parseBucketType(s string) (b2.BucketType, error) {
+	switch t := b2.BucketType(s); t {
+	case b2.AllPrivate, b2.AllPublic:
+		return t, nil
+	}
+	return "", usageError(fmt.Sprintf("Bucket type must be %s or %s, not %q", b2.AllPrivate, b2.AllPublic, s))
+}
+
+// infoFlag collects repeated key=value flags into file info.
+type infoFlag map[string]string
+
+func (f infoFlag) String() string {
+	pairs := []string{}
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f infoFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("Expected key=value, got %q", s)
+	}
+	f[s[:i]] = s[i+1:]
+	return nil
+}
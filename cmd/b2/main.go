@@ -0,0 +1,279 @@
+// Command b2 is a command-line client for Backblaze B2, built on the b2
+// package.
+//
+// Credentials are read from the B2_ACCOUNT_ID and B2_APPLICATION_KEY
+// environment variables, or from the account file saved by "b2 authorize".
+// Every command accepts --json to print its result as JSON for scripting.
+//
+// The exit code is 0 on success, 1 for local errors, 2 for usage errors, and
+// one of the codes below when B2 returns an error.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ifo/b2"
+)
+
+// Exit codes, which scripts can use to tell failures apart.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitBadRequest   = 3 // 400
+	exitUnauthorized = 4 // 401
+	exitForbidden    = 5 // 403
+	exitNotFound     = 6 // 404
+	exitConflict     = 7 // 409, 412, 416 and bucket revision conflicts
+	exitRetryable    = 8 // 408, 429 and 5xx
+	exitAPI          = 9 // any other API error
+)
+
+// command is a subcommand, run with the arguments after its name.
+type command struct {
+	usage string
+	run   func(a *app, args []string) error
+}
+
+// commands is set in init, as the commands refer to it for their usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"authorize":      {"[accountID applicationKey]", (*app).authorize},
+		"list-buckets":   {"", (*app).listBuckets},
+		"create-bucket":  {"[--type allPrivate|allPublic] bucket", (*app).createBucket},
+		"update-bucket":  {"--type allPrivate|allPublic bucket", (*app).updateBucket},
+		"delete-bucket":  {"bucket", (*app).deleteBucket},
+		"ls":             {"[--versions] [--recursive] bucket [prefix]", (*app).ls},
+		"upload":         {"[--content-type type] [--info key=value]... bucket localPath name", (*app).upload},
+		"download":       {"[--id] bucket name|fileID localPath", (*app).download},
+		"hide":           {"bucket name", (*app).hide},
+		"rm":             {"[--id fileID] [--all-versions] bucket name", (*app).rm},
+		"get-file-info":  {"fileID", (*app).getFileInfo},
+		"get-upload-url": {"bucket", (*app).getUploadURL},
+	}
+}
+
+// usageError is an error in how a command was called.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// app holds the state of one run of the tool.
+type app struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	getenv   func(string) string
+	json     bool
+	b2Client *b2.B2
+}
+
+func main() {
+	a := &app{stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	os.Exit(a.main(os.Args[1:]))
+}
+
+// main runs a command and returns the exit code.
+func (a *app) main(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(a.stderr, "b2: unknown command %q\n", args[0])
+		a.usage()
+		return exitUsage
+	}
+
+	err := cmd.run(a, args[1:])
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(a.stderr, "b2 %s: %s\n", args[0], err)
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintf(a.stderr, "usage: b2 %s [--json] %s\n", args[0], cmd.usage)
+		}
+	}
+	return exitCode(err)
+}
+
+func (a *app) usage() {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(a.stderr, "usage: b2 command [--json] [arguments]")
+	fmt.Fprintln(a.stderr)
+	for _, name := range names {
+		fmt.Fprintf(a.stderr, "  %s %s\n", name, commands[name].usage)
+	}
+}
+
+// exitCode maps an error to an exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var usage usageError
+	if errors.As(err, &usage) {
+		return exitUsage
+	}
+	if errors.Is(err, b2.ErrRevisionConflict) {
+		return exitConflict
+	}
+	var apiErr *b2.APIError
+	if !errors.As(err, &apiErr) {
+		return exitError
+	}
+	switch s := apiErr.Status; {
+	case s == 400:
+		return exitBadRequest
+	case s == 401:
+		return exitUnauthorized
+	case s == 403:
+		return exitForbidden
+	case s == 404:
+		return exitNotFound
+	case s == 409 || s == 412 || s == 416:
+		return exitConflict
+	case s == 408 || s == 429 || s >= 500:
+		return exitRetryable
+	}
+	return exitAPI
+}
+
+// flags returns a FlagSet for a command, with the --json flag every command
+// accepts.
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.BoolVar(&a.json, "json", false, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: b2 %s [--json] %s\n", name, commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses a command's flags, and checks it has between min and max
+// positional arguments.
+func parse(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+		return usageError(err.Error())
+	}
+	if n := fs.NArg(); n < min || n > max {
+		return usageError(fmt.Sprintf("Expected %d to %d arguments, got %d", min, max, n))
+	}
+	return nil
+}
+
+// print writes v as JSON with --json, or otherwise calls text.
+func (a *app) print(v interface{}, text func(w io.Writer)) error {
+	if !a.json {
+		text(a.stdout)
+		return nil
+	}
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// account is the saved credentials of "b2 authorize".
+type account struct {
+	AccountID      string `json:"accountId"`
+	ApplicationKey string `json:"applicationKey"`
+}
+
+// accountPath is where credentials are saved, which can be overridden with
+// B2_ACCOUNT_INFO.
+func (a *app) accountPath() (string, error) {
+	if p := a.getenv("B2_ACCOUNT_INFO"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "b2", "account.json"), nil
+}
+
+// credentials returns the account to authorize with, preferring the
+// environment over the saved account.
+func (a *app) credentials() (account, error) {
+	acct := account{AccountID: a.getenv("B2_ACCOUNT_ID"), ApplicationKey: a.getenv("B2_APPLICATION_KEY")}
+	if acct.AccountID != "" && acct.ApplicationKey != "" {
+		return acct, nil
+	}
+	p, err := a.accountPath()
+	if err != nil {
+		return acct, err
+	}
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return acct, fmt.Errorf("No credentials: set B2_ACCOUNT_ID and B2_APPLICATION_KEY, or run b2 authorize")
+	}
+	if err != nil {
+		return acct, err
+	}
+	if err := json.Unmarshal(data, &acct); err != nil {
+		return acct, fmt.Errorf("Invalid account file %s: %s", p, err)
+	}
+	return acct, nil
+}
+
+// saveCredentials writes the account file, readable only by the user.
+func (a *app) saveCredentials(acct account) (string, error) {
+	p, err := a.accountPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(acct, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return p, os.WriteFile(p, data, 0600)
+}
+
+// client returns an authorized client.
+func (a *app) client() (*b2.B2, error) {
+	if a.b2Client != nil {
+		return a.b2Client, nil
+	}
+	acct, err := a.credentials()
+	if err != nil {
+		return nil, err
+	}
+	a.b2Client, err = b2.CreateB2(acct.AccountID, acct.ApplicationKey)
+	return a.b2Client, err
+}
+
+// bucket looks up a bucket by name.
+func (a *app) bucket(name string) (*b2.Bucket, error) {
+	client, err := a.client()
+	if err != nil {
+		return nil, err
+	}
+	return client.BucketByName(name)
+}
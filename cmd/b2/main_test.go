@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ifo/b2"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected int
+	}{
+		{nil, exitOK},
+		{fmt.Errorf("local"), exitError},
+		{usageError("bad"), exitUsage},
+		{b2.ErrRevisionConflict, exitConflict},
+		{&b2.APIError{Status: 400}, exitBadRequest},
+		{&b2.APIError{Status: 401}, exitUnauthorized},
+		{&b2.APIError{Status: 403}, exitForbidden},
+		{&b2.APIError{Status: 404}, exitNotFound},
+		{&b2.APIError{Status: 416}, exitConflict},
+		{&b2.APIError{Status: 429}, exitRetryable},
+		{&b2.APIError{Status: 503}, exitRetryable},
+		{&b2.APIError{Status: 418}, exitAPI},
+		{fmt.Errorf("wrapped: %w", &b2.APIError{Status: 404}), exitNotFound},
+	}
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.expected {
+			t.Errorf("Expected %v to exit with %d, instead got %d", c.err, c.expected, code)
+		}
+	}
+}
+
+func TestApp_main_usage(t *testing.T) {
+	cases := [][]string{
+		{},
+		{"unknown"},
+		{"ls"},
+		{"ls", "--bogus", "bucket"},
+		{"upload", "bucket", "file"},
+		{"authorize", "onlyAnID"},
+		{"create-bucket", "--type", "sideways", "bucket"},
+		{"rm", "--id", "1", "--all-versions", "bucket", "name"},
+	}
+	for _, args := range cases {
+		a, _, stderr := testApp(nil)
+		if code := a.main(args); code != exitUsage {
+			t.Errorf("Expected %v to exit with %d, instead got %d", args, exitUsage, code)
+		}
+		if !strings.Contains(stderr.String(), "usage: b2") {
+			t.Errorf("Expected %v to print usage, instead got %q", args, stderr)
+		}
+	}
+
+	a, _, _ := testApp(nil)
+	if code := a.main([]string{"help"}); code != exitOK {
+		t.Errorf("Expected help to exit with %d, instead got %d", exitOK, code)
+	}
+}
+
+func TestApp_credentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "b2", "account.json")
+	a, _, _ := testApp(map[string]string{"B2_ACCOUNT_INFO": path})
+	if _, err := a.credentials(); err == nil {
+		t.Error("Expected missing credentials to fail")
+	}
+	if code := a.main([]string{"list-buckets"}); code != exitError {
+		t.Errorf("Expected missing credentials to exit with %d, instead got %d", exitError, code)
+	}
+
+	saved := account{AccountID: "id", ApplicationKey: "key"}
+	if _, err := a.saveCredentials(saved); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the account file to be private, instead got %v with %v", info, err)
+	}
+	if acct, err := a.credentials(); err != nil || acct != saved {
+		t.Errorf("Expected %+v, instead got %+v with %v", saved, acct, err)
+	}
+
+	// the environment takes precedence
+	a, _, _ = testApp(map[string]string{"B2_ACCOUNT_INFO": path, "B2_ACCOUNT_ID": "env", "B2_APPLICATION_KEY": "envkey"})
+	if acct, _ := a.credentials(); acct.AccountID != "env" || acct.ApplicationKey != "envkey" {
+		t.Errorf("Expected the environment's credentials, instead got %+v", acct)
+	}
+}
+
+func TestApp_print(t *testing.T) {
+	v := map[string]int{"size": 3}
+	text := func(w io.Writer) { fmt.Fprintln(w, "size 3") }
+
+	a, stdout, _ := testApp(nil)
+	if err := a.print(v, text); err != nil || stdout.String() != "size 3\n" {
+		t.Errorf("Expected text output, instead got %q with %v", stdout, err)
+	}
+	a, stdout, _ = testApp(nil)
+	a.json = true
+	if err := a.print(v, text); err != nil || stdout.String() != "{\n  \"size\": 3\n}\n" {
+		t.Errorf("Expected JSON output, instead got %q with %v", stdout, err)
+	}
+}
+
+func TestInfoFlag(t *testing.T) {
+	info := infoFlag{}
+	for _, s := range []string{"owner=ops", "note=a=b"} {
+		if err := info.Set(s); err != nil {
+			t.Errorf("Expected %q to be valid, instead got %s", s, err)
+		}
+	}
+	if info["owner"] != "ops" || info["note"] != "a=b" {
+		t.Errorf("Expected both pairs, instead got %v", info)
+	}
+	for _, s := range []string{"novalue", "=value"} {
+		if err := info.Set(s); err == nil {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
+
+func testApp(env map[string]string) (*app, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	a := &app{
+		stdout: stdout,
+		stderr: stderr,
+		getenv: func(k string) string { return env[k] },
+	}
+	return a, stdout, stderr
+}
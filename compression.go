@@ -0,0 +1,158 @@
+package b2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The fileInfo keys used to record how a file was compressed. Along with
+// b2-content-encoding, which is set from the codec's name, they count
+// towards the 10 key limit of an upload.
+const (
+	compressCodecKey = "compress_codec"
+	compressSizeKey  = "compress_size"
+	compressSha1Key  = "compress_sha1"
+)
+
+// Codec compresses and decompresses file data.
+//
+// Its Name is stored with the file and sent as the file's Content-Encoding,
+// so it should be an HTTP content coding such as "gzip" or "zstd".
+type Codec interface {
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip is a Codec using compress/gzip. It is registered by default.
+var Gzip Codec = gzipCodec{}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"gzip": Gzip}
+)
+
+// RegisterCodec makes a Codec available for decompressing downloads.
+//
+// This package has no dependencies outside the standard library, so only
+// gzip is built in. A zstd Codec can be registered by wrapping a zstd
+// package.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+func lookupCodec(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// acceptEncoding lists the registered codecs, for the Accept-Encoding of a
+// download that will be decompressed.
+func acceptEncoding() string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := []string{}
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// compressUpload compresses file with the options' Compression codec. It
+// returns the compressed data, and a copy of the options with the codec,
+// original size and original sha1 added to the file info.
+func compressUpload(file io.Reader, opts *UploadOptions) (io.Reader, *UploadOptions, error) {
+	c := opts.Compression
+	if opts.ContentEncoding != "" {
+		return nil, nil, fmt.Errorf("ContentEncoding can't be set with Compression")
+	}
+	original, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := c.NewWriter(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.Write(original); err != nil {
+		return nil, nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	out := *opts
+	out.Compression = nil
+	out.FileInfo = map[string]string{}
+	for k, v := range opts.FileInfo {
+		out.FileInfo[k] = v
+	}
+	out.FileInfo[compressCodecKey] = c.Name()
+	out.FileInfo[compressSizeKey] = strconv.Itoa(len(original))
+	out.FileInfo[compressSha1Key] = fmt.Sprintf("%x", sha1.Sum(original))
+	out.ContentEncoding = c.Name()
+	return buf, &out, nil
+}
+
+// decompressFile replaces the data of a downloaded File that was uploaded
+// with compression, and checks it against the original size and sha1.
+// Files that weren't compressed are returned unchanged.
+func decompressFile(f *File) (*File, error) {
+	name, ok := f.Meta.FileInfo[compressCodecKey]
+	if !ok {
+		return f, nil
+	}
+	c, ok := lookupCodec(name)
+	if !ok {
+		return nil, fmt.Errorf("No codec registered for %s", name)
+	}
+
+	r, err := c.NewReader(bytes.NewReader(f.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if size := f.Meta.FileInfo[compressSizeKey]; size != strconv.Itoa(len(data)) {
+		return nil, fmt.Errorf("Decompressed size %d didn't match original size %s", len(data), size)
+	}
+	if fmt.Sprintf("%x", sha1.Sum(data)) != f.Meta.FileInfo[compressSha1Key] {
+		return nil, fmt.Errorf("Decompressed sha1 didn't match original sha1")
+	}
+
+	meta := f.Meta
+	meta.Size = int64(len(data))
+	meta.ContentLength = int64(len(data))
+	return &File{Meta: meta, Data: data}, nil
+}
@@ -0,0 +1,218 @@
+package b2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBucket_UploadFileWithOptions_compression(t *testing.T) {
+	original := bytes.Repeat([]byte("log line\n"), 100)
+	stored := testCompressedUpload(t, original, Gzip)
+
+	if len(stored.data) >= len(original) {
+		t.Errorf("Expected compressed data to be smaller than %d, instead got %d", len(original), len(stored.data))
+	}
+	checks := map[string]string{
+		"X-Bz-Info-compress_codec":      "gzip",
+		"X-Bz-Info-compress_size":       "900",
+		"X-Bz-Info-compress_sha1":       fmt.Sprintf("%x", sha1.Sum(original)),
+		"X-Bz-Info-b2-content-encoding": "gzip",
+	}
+	for k, v := range checks {
+		if stored.headers.Get(k) != v {
+			t.Errorf("Expected header %s to be %s, instead got %s", k, v, stored.headers.Get(k))
+		}
+	}
+
+	bucket := testBucket()
+	bucket.B2.client = &testReplayClientFunc{fn: stored.respond}
+	f, err := bucket.DownloadFileByNameWithOptions("name", &DownloadOptions{Decompress: true})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !bytes.Equal(f.Data, original) {
+		t.Errorf("Expected the original data, instead got %q", f.Data)
+	}
+	if f.Meta.Size != int64(len(original)) {
+		t.Errorf("Expected size to be %d, instead got %d", len(original), f.Meta.Size)
+	}
+
+	// without Decompress the stored data is returned
+	f, err = bucket.DownloadFileByName("name")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !bytes.Equal(f.Data, stored.data) {
+		t.Error("Expected the compressed data")
+	}
+}
+
+func TestBucket_UploadFileWithOptions_compressionInfoLimit(t *testing.T) {
+	bucket := testBucket()
+	info := map[string]string{"1": "", "2": "", "3": "", "4": "", "5": "", "6": "", "7": ""}
+	fm, err := bucket.UploadFileWithOptions("name", strings.NewReader("cats"), &UploadOptions{FileInfo: info, Compression: Gzip})
+	if err == nil || err.Error() != "More than 10 file info keys provided" {
+		t.Errorf("Expected too many file info keys, instead got %v", err)
+	}
+	if fm != nil {
+		t.Errorf("Expected fm to be nil, instead got %+v", fm)
+	}
+}
+
+func TestDecompressFile(t *testing.T) {
+	RegisterCodec(testReverseCodec{})
+	original := []byte("cats and dogs")
+	stored := testCompressedUpload(t, original, testReverseCodec{})
+	file := &File{
+		Meta: FileMeta{FileInfo: GetBzInfoHeaders(&http.Response{Header: stored.headers})},
+		Data: stored.data,
+	}
+
+	f, err := decompressFile(file)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !bytes.Equal(f.Data, original) {
+		t.Errorf("Expected %q, instead got %q", original, f.Data)
+	}
+
+	file.Meta.FileInfo[compressSha1Key] = "bad"
+	if _, err := decompressFile(file); err == nil {
+		t.Error("Expected a sha1 mismatch to fail")
+	}
+
+	file.Meta.FileInfo[compressCodecKey] = "unknown"
+	if _, err := decompressFile(file); err == nil {
+		t.Error("Expected an unregistered codec to fail")
+	}
+
+	plain := &File{Meta: FileMeta{FileInfo: map[string]string{}}, Data: []byte("x")}
+	if f, err := decompressFile(plain); err != nil || f != plain {
+		t.Errorf("Expected an uncompressed file to be unchanged, instead got %+v, %v", f, err)
+	}
+}
+
+func TestBucket_DownloadFileByNameWithOptions_decompress(t *testing.T) {
+	bucket := testBucket()
+	opts := &DownloadOptions{Decompress: true, Range: &ByteRange{Start: 0, End: 1}}
+	if _, err := bucket.DownloadFileByNameWithOptions("name", opts); err == nil {
+		t.Error("Expected decompressing a range to fail")
+	}
+
+	bucket.DownloadFileByNameWithOptions("name", &DownloadOptions{Decompress: true})
+	req := bucket.B2.client.(*testClient).Request
+	if ae := req.Header.Get("Accept-Encoding"); !strings.Contains(ae, "gzip") || strings.Contains(ae, "br") {
+		t.Errorf("Expected Accept-Encoding to list the registered codecs, instead got %q", ae)
+	}
+
+	bucket.DownloadFileByName("name")
+	req = bucket.B2.client.(*testClient).Request
+	if ae := req.Header.Get("Accept-Encoding"); ae != "identity" {
+		t.Errorf("Expected Accept-Encoding to be identity, instead got %q", ae)
+	}
+}
+
+func TestBucket_DownloadFileByName_contentEncoding(t *testing.T) {
+	// a file stored gzipped, but downloaded without Decompress, must be
+	// returned as stored
+	bucket, fake := testFakeBucket()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, _ := fake.Do(r)
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+	bucket.B2.client = server.Client()
+	bucket.B2.DownloadURL = server.URL
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Write([]byte("cats"))
+	gw.Close()
+	fake.put("id", "cats.txt.gz", buf.Bytes(), nil)
+
+	f, err := bucket.DownloadFileByName("cats.txt.gz")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !bytes.Equal(f.Data, buf.Bytes()) {
+		t.Errorf("Expected the stored gzip data, instead got %q", f.Data)
+	}
+}
+
+// testReverseCodec "compresses" by reversing the data.
+type testReverseCodec struct{}
+
+func (testReverseCodec) Name() string { return "reverse" }
+
+func (testReverseCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return &testReverseWriter{w: w}, nil
+}
+
+func (testReverseCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(testReverse(b))), nil
+}
+
+type testReverseWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (rw *testReverseWriter) Write(p []byte) (int, error) {
+	rw.buf = append(rw.buf, p...)
+	return len(p), nil
+}
+
+func (rw *testReverseWriter) Close() error {
+	_, err := rw.w.Write(testReverse(rw.buf))
+	return err
+}
+
+func testReverse(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+func testCompressedUpload(t *testing.T, original []byte, c Codec) *testStoredFile {
+	bucket := testBucket()
+	bucket.UploadURLs = []*UploadURL{testUploadURL()}
+	rc := testReplayClient(testFileMetaJSON("id", "name", "sha1"))
+	bucket.B2.client = rc
+
+	_, err := bucket.UploadFileWithOptions("name", bytes.NewReader(original), &UploadOptions{Compression: c})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	req := rc.Requests[0]
+	data, _ := ioutil.ReadAll(req.Body)
+	headers := http.Header{
+		"X-Bz-File-Id":      {"id"},
+		"X-Bz-File-Name":    {"name"},
+		"X-Bz-Content-Sha1": {fmt.Sprintf("%x", sha1.Sum(data))},
+	}
+	for k, v := range req.Header {
+		if strings.HasPrefix(k, "X-Bz-Info-") {
+			headers[k] = v
+		}
+	}
+	return &testStoredFile{data: data, headers: headers}
+}
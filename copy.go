@@ -0,0 +1,342 @@
+package b2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCopySize is the largest file b2_copy_file can copy.
+const maxCopySize = 5 * 1000 * 1000 * 1000
+
+// SourceAction is what happens to the source file of a Rename or Move once
+// its copy has been verified.
+type SourceAction int
+
+// The source may be hidden, leaving its versions in place, or have all of
+// its versions deleted.
+const (
+	SourceHide SourceAction = iota
+	SourceDelete
+)
+
+// CopyOptions are the optional settings of a server-side copy.
+type CopyOptions struct {
+	// SourceEncryption must hold the customer key when copying a file that
+	// was uploaded with SSE-C.
+	SourceEncryption *Encryption
+
+	// DestinationEncryption is the server-side encryption of the copy. If
+	// nil, the destination bucket's default encryption is used.
+	DestinationEncryption *Encryption
+}
+
+// copyFileRequest is used for making a server-side copy of a file.
+type copyFileRequest struct {
+	SourceFileID                    string      `json:"sourceFileId"`
+	DestinationBucketID             string      `json:"destinationBucketId,omitempty"`
+	FileName                        string      `json:"fileName"`
+	SourceServerSideEncryption      *Encryption `json:"sourceServerSideEncryption,omitempty"`
+	DestinationServerSideEncryption *Encryption `json:"destinationServerSideEncryption,omitempty"`
+}
+
+// CopyFile makes a server-side copy of the file with the given ID, naming
+// the copy newName.
+//
+// If dest is nil the copy is placed in this Bucket, otherwise it is placed in
+// dest, which must be under the same account. The returned FileMeta refers
+// to the Bucket the copy was placed in.
+func (b *Bucket) CopyFile(fileID, newName string, dest *Bucket) (*FileMeta, error) {
+	return b.CopyFileWithOptions(fileID, newName, dest, nil)
+}
+
+// CopyFileWithOptions makes a server-side copy of a file, like CopyFile,
+// with the given copy options.
+func (b *Bucket) CopyFileWithOptions(fileID, newName string, dest *Bucket, opts *CopyOptions) (*FileMeta, error) {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	if fileID == "" {
+		return nil, fmt.Errorf("No fileID provided")
+	}
+	if newName == "" {
+		return nil, fmt.Errorf("No file name provided")
+	}
+	if err := ValidateFileName(newName); err != nil {
+		return nil, err
+	}
+	if dest == nil {
+		dest = b
+	}
+	if err := opts.SourceEncryption.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.DestinationEncryption.validate(); err != nil {
+		return nil, err
+	}
+
+	cfr := copyFileRequest{
+		SourceFileID:                    fileID,
+		FileName:                        newName,
+		SourceServerSideEncryption:      opts.SourceEncryption.withDefaults(),
+		DestinationServerSideEncryption: opts.DestinationEncryption.withDefaults(),
+	}
+	if dest.ID != b.ID {
+		cfr.DestinationBucketID = dest.ID
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_copy_file", cfr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return dest.parseFileMeta(resp)
+}
+
+// Rename gives the current version of a file a new name.
+//
+// B2 has no rename, so the file is copied server-side, the sha1 of the copy
+// is checked against the original, and only then is the original hidden or
+// deleted according to action.
+func (b *Bucket) Rename(oldName, newName string, action SourceAction) (*FileMeta, error) {
+	return b.MoveWithOptions(oldName, b, newName, action, nil)
+}
+
+// RenameWithOptions renames a file, like Rename, with the given copy
+// options. A file uploaded with SSE-C can only be renamed with its key as
+// the SourceEncryption, and unless a DestinationEncryption is given the
+// renamed file is encrypted with the same key.
+func (b *Bucket) RenameWithOptions(oldName, newName string, action SourceAction, opts *CopyOptions) (*FileMeta, error) {
+	return b.MoveWithOptions(oldName, b, newName, action, opts)
+}
+
+// Move copies the current version of a file to dest under newName, then
+// hides or deletes the original according to action.
+//
+// If newName is empty the file keeps its name. The original is left
+// untouched if the copy fails or its sha1 does not match. If the copy
+// succeeds but the original can't be hidden or deleted, the copy's FileMeta
+// is returned along with the error. Files larger than
+// 5GB, and large files started without a large_file_sha1, can't be moved,
+// since they can't be copied in one request or their copy can't be
+// verified.
+func (b *Bucket) Move(name string, dest *Bucket, newName string, action SourceAction) (*FileMeta, error) {
+	return b.MoveWithOptions(name, dest, newName, action, nil)
+}
+
+// MoveWithOptions moves a file, like Move, with the given copy options. A
+// file uploaded with SSE-C can only be moved with its key as the
+// SourceEncryption, and unless a DestinationEncryption is given the moved
+// file is encrypted with the same key.
+func (b *Bucket) MoveWithOptions(name string, dest *Bucket, newName string, action SourceAction, opts *CopyOptions) (*FileMeta, error) {
+	if name == "" {
+		return nil, fmt.Errorf("No file name provided")
+	}
+	if dest == nil {
+		dest = b
+	}
+	if newName == "" {
+		newName = name
+	}
+	if dest.ID == b.ID && newName == name {
+		return nil, fmt.Errorf("Source and destination are the same file")
+	}
+
+	src, err := b.currentFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.moveFile(src, dest, newName, action, opts)
+}
+
+// RenamePrefix renames every current file whose name begins with oldPrefix,
+// replacing oldPrefix with newPrefix. It is the equivalent of renaming a
+// directory.
+//
+// The prefixes may not overlap, since files copied into newPrefix would
+// then be among the files being moved. Every file is checked before any is
+// moved, so a file that can't be moved fails the rename up front. Files are
+// then moved one at a time. The FileMeta of every completed copy is
+// returned, even if a later file fails.
+func (b *Bucket) RenamePrefix(oldPrefix, newPrefix string, action SourceAction) ([]FileMeta, error) {
+	return b.RenamePrefixWithOptions(oldPrefix, newPrefix, action, nil)
+}
+
+// RenamePrefixWithOptions renames every file with a prefix, like
+// RenamePrefix, with the given copy options. Every file is copied with the
+// same options, so files uploaded with SSE-C must all share the key given
+// as the SourceEncryption. Unless a DestinationEncryption is given, the
+// renamed files are encrypted with the same key.
+func (b *Bucket) RenamePrefixWithOptions(oldPrefix, newPrefix string, action SourceAction, opts *CopyOptions) ([]FileMeta, error) {
+	if oldPrefix == "" {
+		return nil, fmt.Errorf("No prefix provided")
+	}
+	if oldPrefix == newPrefix {
+		return nil, fmt.Errorf("Source and destination prefixes are the same")
+	}
+	if overlaps(oldPrefix, newPrefix) {
+		return nil, fmt.Errorf("Prefixes %q and %q overlap", oldPrefix, newPrefix)
+	}
+
+	srcs, err := b.listPrefix(oldPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range srcs {
+		if err := movable(src); err != nil {
+			return nil, err
+		}
+	}
+
+	moved := []FileMeta{}
+	for _, src := range srcs {
+		newName := newPrefix + strings.TrimPrefix(src.Name, oldPrefix)
+		fm, err := b.moveFile(src, b, newName, action, opts)
+		if fm != nil {
+			moved = append(moved, *fm)
+		}
+		if err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
+
+// moveFile copies src to dest, verifies the copy, and then hides or deletes
+// the source file. If the source can't be removed, the copy is returned
+// with the error.
+func (b *Bucket) moveFile(src FileMeta, dest *Bucket, newName string, action SourceAction, opts *CopyOptions) (*FileMeta, error) {
+	if action != SourceHide && action != SourceDelete {
+		return nil, fmt.Errorf("Unknown source action %d", action)
+	}
+	fm, err := b.verifiedCopy(src, dest, newName, opts.keepSSEC())
+	if err != nil {
+		return nil, err
+	}
+
+	if action == SourceHide {
+		_, err = b.HideFile(src.Name)
+	} else {
+		err = b.deleteAllVersions(src.Name)
+	}
+	return fm, err
+}
+
+// verifiedCopy copies src to dest and checks that the copy has the same
+// sha1. The sha1 of a large file is its large_file_sha1.
+func (b *Bucket) verifiedCopy(src FileMeta, dest *Bucket, newName string, opts *CopyOptions) (*FileMeta, error) {
+	if err := movable(src); err != nil {
+		return nil, err
+	}
+	fm, err := b.CopyFileWithOptions(src.ID, newName, dest, opts)
+	if err != nil {
+		return nil, err
+	}
+	if fileSha1(fm) != fileSha1(&src) {
+		return nil, fmt.Errorf("Copy sha1 %s didn't match source sha1 %s", fileSha1(fm), fileSha1(&src))
+	}
+	return fm, nil
+}
+
+// keepSSEC returns copy options that encrypt the copy of an SSE-C file with
+// the source's key, unless another DestinationEncryption was given, so that
+// moving a file doesn't remove its encryption.
+func (opts *CopyOptions) keepSSEC() *CopyOptions {
+	if opts == nil || opts.DestinationEncryption != nil || opts.SourceEncryption == nil ||
+		opts.SourceEncryption.Mode != EncryptionSSEC {
+		return opts
+	}
+	keep := *opts
+	keep.DestinationEncryption = opts.SourceEncryption
+	return &keep
+}
+
+// movable checks that a file can be copied in one request, and that its
+// sha1 is known so the copy can be verified before the source is removed.
+func movable(src FileMeta) error {
+	if src.ContentLength > maxCopySize {
+		return fmt.Errorf("File %s is larger than 5GB and can't be copied", src.Name)
+	}
+	if fileSha1(&src) == "" {
+		return fmt.Errorf("File %s has no sha1, so its copy can't be verified", src.Name)
+	}
+	return nil
+}
+
+// overlaps reports whether one prefix contains the other.
+func overlaps(a, b string) bool {
+	return strings.HasPrefix(a, b) || strings.HasPrefix(b, a)
+}
+
+// currentFile returns the FileMeta of the current version of a named file.
+func (b *Bucket) currentFile(name string) (FileMeta, error) {
+	lfr, err := b.ListFileNames(name, 1)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	if len(lfr.Files) == 0 || lfr.Files[0].Name != name {
+		return FileMeta{}, fmt.Errorf("File %s not found", name)
+	}
+	return lfr.Files[0], nil
+}
+
+// listPrefix returns the FileMeta of every current file whose name begins
+// with prefix. B2 filters the listing by prefix, but names are checked
+// again so that files outside the prefix are never acted on.
+func (b *Bucket) listPrefix(prefix string) ([]FileMeta, error) {
+	files := []FileMeta{}
+	next := ""
+	for {
+		lfr, err := b.ListFileNamesWithPrefix(prefix, "", next, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range lfr.Files {
+			if strings.HasPrefix(f.Name, prefix) {
+				files = append(files, f)
+			}
+		}
+		if lfr.NextFileName == "" {
+			return files, nil
+		}
+		next = lfr.NextFileName
+	}
+}
+
+// FileVersions returns the FileMeta of every version of a named file,
+// newest first. Listing stops at the first other name, so files the name is
+// a prefix of aren't listed.
+func (b *Bucket) FileVersions(name string) ([]FileMeta, error) {
+	versions := []FileMeta{}
+	nextName, nextID := name, ""
+	for nextName == name {
+		lfr, err := b.ListFileVersions(nextName, nextID, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range lfr.Files {
+			if f.Name != name {
+				return versions, nil
+			}
+			versions = append(versions, f)
+		}
+		nextName, nextID = lfr.NextFileName, lfr.NextFileID
+	}
+	return versions, nil
+}
+
+// deleteAllVersions deletes every version of a named file.
+func (b *Bucket) deleteAllVersions(name string) error {
+	versions, err := b.FileVersions(name)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if _, err := b.DeleteFileVersion(v.Name, v.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package b2
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestBucket_CopyFile(t *testing.T) {
+	bucket := testBucket()
+	cases := []struct {
+		id, name    string
+		expectedErr string
+	}{
+		{id: "", name: "name", expectedErr: "No fileID provided"},
+		{id: "id", name: "", expectedErr: "No file name provided"},
+	}
+	for _, c := range cases {
+		fm, err := bucket.CopyFile(c.id, c.name, nil)
+		if err == nil || err.Error() != c.expectedErr {
+			t.Errorf("Expected err to be %s, instead got %v", c.expectedErr, err)
+		}
+		if fm != nil {
+			t.Errorf("Expected fm to be nil, instead got %+v", fm)
+		}
+	}
+
+	bucket.CopyFile("id", "name", nil)
+	req := bucket.B2.client.(*testClient).Request
+	auth, ok := req.Header["Authorization"]
+	if !ok || auth[0] != bucket.B2.AuthorizationToken {
+		t.Errorf("Expected auth to be %s, instead got %s", bucket.B2.AuthorizationToken, auth)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if bytes.Contains(body, []byte("destinationBucketId")) {
+		t.Errorf("Expected no destinationBucketId for a same bucket copy, got %s", body)
+	}
+
+	dest := testBucket()
+	dest.ID = "other"
+	bucket.CopyFile("id", "name", dest)
+	req = bucket.B2.client.(*testClient).Request
+	body, _ = ioutil.ReadAll(req.Body)
+	if !bytes.Contains(body, []byte(`"destinationBucketId":"other"`)) {
+		t.Errorf("Expected destinationBucketId to be other, got %s", body)
+	}
+}
+
+func TestBucket_Rename(t *testing.T) {
+	bucket := testBucket()
+	if _, err := bucket.Rename("same", "same", SourceHide); err == nil {
+		t.Error("Expected renaming a file to itself to fail")
+	}
+
+	cases := []struct {
+		action SourceAction
+		resps  []string
+		paths  []string
+	}{
+		{
+			action: SourceHide,
+			resps: []string{
+				testListJSON(testFileMetaJSON("id0", "old", "sha1")),
+				testFileMetaJSON("id1", "new", "sha1"),
+				testFileMetaJSON("id2", "old", "none"),
+			},
+			paths: []string{"b2_list_file_names", "b2_copy_file", "b2_hide_file"},
+		},
+		{
+			action: SourceDelete,
+			resps: []string{
+				testListJSON(testFileMetaJSON("id0", "old", "sha1")),
+				testFileMetaJSON("id1", "new", "sha1"),
+				testListJSON(testFileMetaJSON("id0", "old", "sha1"), testFileMetaJSON("idx", "old", "sha2")),
+				testFileMetaJSON("id0", "old", "sha1"),
+				testFileMetaJSON("idx", "old", "sha2"),
+			},
+			paths: []string{"b2_list_file_names", "b2_copy_file", "b2_list_file_versions",
+				"b2_delete_file_version", "b2_delete_file_version"},
+		},
+	}
+
+	for i, c := range cases {
+		rc := testReplayClient(c.resps...)
+		bucket := testBucket()
+		bucket.B2.client = rc
+		fm, err := bucket.Rename("old", "new", c.action)
+		if err != nil {
+			t.Fatalf("Expected no error, instead got %s, case %d", err, i)
+		}
+		if fm.Name != "new" || fm.ID != "id1" {
+			t.Errorf("Expected the copied file, instead got %+v, case %d", fm, i)
+		}
+		checkPaths(rc, c.paths, t)
+	}
+}
+
+func TestBucket_Move_sha1Mismatch(t *testing.T) {
+	rc := testReplayClient(
+		testListJSON(testFileMetaJSON("id0", "old", "sha1")),
+		testFileMetaJSON("id1", "old", "different"),
+	)
+	bucket := testBucket()
+	bucket.B2.client = rc
+	dest := testBucket()
+	dest.ID = "other"
+
+	fm, err := bucket.Move("old", dest, "", SourceDelete)
+	if err == nil {
+		t.Fatal("Expected a sha1 mismatch error")
+	}
+	if fm != nil {
+		t.Errorf("Expected fm to be nil, instead got %+v", fm)
+	}
+	// the source must not be touched
+	checkPaths(rc, []string{"b2_list_file_names", "b2_copy_file"}, t)
+}
+
+func TestBucket_RenamePrefix(t *testing.T) {
+	rc := testReplayClient(
+		testListJSON(
+			testFileMetaJSON("id0", "dir/a", "sha1"),
+			testFileMetaJSON("id1", "dir/b", "sha2"),
+			testFileMetaJSON("id2", "dirt", "sha3"),
+		),
+		testFileMetaJSON("id3", "new/a", "sha1"),
+		testFileMetaJSON("id0", "dir/a", "none"),
+		testFileMetaJSON("id4", "new/b", "sha2"),
+		testFileMetaJSON("id1", "dir/b", "none"),
+	)
+	bucket := testBucket()
+	bucket.B2.client = rc
+
+	moved, err := bucket.RenamePrefix("dir/", "new/", SourceHide)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(moved) != 2 {
+		t.Fatalf("Expected 2 moved files, instead got %d", len(moved))
+	}
+	if moved[0].Name != "new/a" || moved[1].Name != "new/b" {
+		t.Errorf("Expected new/a and new/b, instead got %s and %s", moved[0].Name, moved[1].Name)
+	}
+	body, _ := ioutil.ReadAll(rc.Requests[0].Body)
+	if !bytes.Contains(body, []byte(`"prefix":"dir/"`)) {
+		t.Errorf("Expected listing to use the prefix, instead got %s", body)
+	}
+	body, _ = ioutil.ReadAll(rc.Requests[1].Body)
+	if !bytes.Contains(body, []byte(`"fileName":"new/a"`)) {
+		t.Errorf("Expected copy to be named new/a, instead got %s", body)
+	}
+}
+
+func TestBucket_RenameWithOptions_encryption(t *testing.T) {
+	rc := testReplayClient(
+		testListJSON(testFileMetaJSON("id0", "old", "sha1")),
+		testFileMetaJSON("id1", "new", "sha1"),
+		testFileMetaJSON("id2", "old", "none"),
+	)
+	bucket := testBucket()
+	bucket.B2.client = rc
+	ssec, _ := SSEC(testSSECKey())
+
+	if _, err := bucket.RenameWithOptions("old", "new", SourceHide, &CopyOptions{SourceEncryption: ssec}); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	body, _ := ioutil.ReadAll(rc.Requests[1].Body)
+	for _, field := range []string{"sourceServerSideEncryption", "destinationServerSideEncryption"} {
+		if !bytes.Contains(body, []byte(`"`+field+`":{"mode":"SSE-C","algorithm":"AES256","customerKey":"`+ssec.CustomerKey)) {
+			t.Errorf("Expected the copy to send the key as its %s, instead got %s", field, body)
+		}
+	}
+}
+
+func TestCopyOptions_keepSSEC(t *testing.T) {
+	ssec, _ := SSEC(testSSECKey())
+	if opts := (*CopyOptions)(nil).keepSSEC(); opts != nil {
+		t.Errorf("Expected nil options to stay nil, instead got %+v", opts)
+	}
+	opts := &CopyOptions{SourceEncryption: ssec, DestinationEncryption: SSEB2()}
+	if kept := opts.keepSSEC(); kept.DestinationEncryption.Mode != EncryptionSSEB2 {
+		t.Errorf("Expected a given destination encryption to be kept, instead got %+v", kept.DestinationEncryption)
+	}
+	opts = &CopyOptions{SourceEncryption: ssec}
+	if kept := opts.keepSSEC(); kept.DestinationEncryption != ssec || opts.DestinationEncryption != nil {
+		t.Errorf("Expected a copy of the options using the source key, instead got %+v", kept)
+	}
+}
+
+func TestBucket_RenamePrefix_sourceFailure(t *testing.T) {
+	// the listing and first copy succeed, then hiding the source fails
+	rc := testReplayClient(
+		testListJSON(
+			testFileMetaJSON("id0", "dir/a", "sha1"),
+			testFileMetaJSON("id1", "dir/b", "sha2"),
+		),
+		testFileMetaJSON("id3", "new/a", "sha1"),
+	)
+	bucket := testBucket()
+	bucket.B2.client = rc
+
+	moved, err := bucket.RenamePrefix("dir/", "new/", SourceHide)
+	if err == nil {
+		t.Fatal("Expected the hide to fail")
+	}
+	if len(moved) != 1 || moved[0].Name != "new/a" {
+		t.Errorf("Expected the copy new/a to be returned, instead got %+v", moved)
+	}
+	checkPaths(rc, []string{"b2_list_file_names", "b2_copy_file", "b2_hide_file"}, t)
+
+	// an unknown action fails before anything is copied
+	src := FileMeta{ID: "id1", Name: "dir/b", ContentSha1: "sha2"}
+	if _, err := bucket.moveFile(src, bucket, "new/b", SourceAction(9), nil); err == nil {
+		t.Error("Expected an unknown source action to fail")
+	}
+	if len(rc.Requests) != 3 {
+		t.Errorf("Expected no more requests, instead got %v", rc.paths())
+	}
+}
+
+func TestBucket_RenamePrefix_overlapping(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "logs/a", []byte("new"), nil)
+	fake.put("id", "logs/archive/a", []byte("old"), nil)
+
+	for _, c := range [][2]string{{"logs/", "logs/archive/"}, {"logs/archive/", "logs/"}} {
+		if _, err := bucket.RenamePrefix(c[0], c[1], SourceDelete); err == nil {
+			t.Errorf("Expected %q to %q to fail", c[0], c[1])
+		}
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("Expected no requests, instead got %d", len(fake.requests))
+	}
+	if data, _ := fake.data("id", "logs/archive/a"); string(data) != "old" {
+		t.Errorf("Expected logs/archive/a to be untouched, instead got %q", data)
+	}
+}
+
+func TestBucket_Move_unverifiable(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "big", []byte("big"), nil)
+	fake.put("id", "ok", []byte("ok"), nil)
+	fake.versions[0].meta.ContentSha1 = "none"
+
+	if _, err := bucket.Move("big", nil, "moved", SourceDelete); err == nil {
+		t.Error("Expected a file without a sha1 not to be moved")
+	}
+	moved, err := bucket.RenamePrefix("b", "moved/", SourceDelete)
+	if err == nil || len(moved) != 0 {
+		t.Errorf("Expected the rename to fail before moving anything, instead got %v and %v", moved, err)
+	}
+	if _, ok := fake.data("id", "big"); !ok {
+		t.Error("Expected big not to be deleted")
+	}
+	if _, ok := fake.data("id", "moved"); ok {
+		t.Error("Expected big not to be copied")
+	}
+}
+
+func TestMovable(t *testing.T) {
+	cases := []struct {
+		meta    FileMeta
+		success bool
+	}{
+		{meta: FileMeta{ContentSha1: "sha1"}, success: true},
+		{meta: FileMeta{ContentSha1: "unverified:sha1"}, success: true},
+		{meta: FileMeta{ContentSha1: "none", FileInfo: map[string]string{"large_file_sha1": "sha1"}}, success: true},
+		{meta: FileMeta{ContentSha1: "none"}, success: false},
+		{meta: FileMeta{ContentSha1: "sha1", ContentLength: maxCopySize + 1}, success: false},
+	}
+	for i, c := range cases {
+		if err := movable(c.meta); (err == nil) != c.success {
+			t.Errorf("Expected success to be %t, instead got %v, case %d", c.success, err, i)
+		}
+	}
+}
+
+func TestBucket_FileVersions(t *testing.T) {
+	// the first page ends past the name, so no more pages are listed
+	rc := testReplayClient(`{"files":[` +
+		testFileMetaJSON("2", "a", "sha1") + "," +
+		testFileMetaJSON("1", "a", "sha1") + "," +
+		testFileMetaJSON("3", "a/b", "sha1") +
+		`],"nextFileName":"b","nextFileId":"4"}`)
+	bucket := testBucket()
+	bucket.B2.client = rc
+
+	versions, err := bucket.FileVersions("a")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(versions) != 2 || versions[0].ID != "2" || versions[1].ID != "1" {
+		t.Errorf("Expected versions 2 and 1 of a, instead got %+v", versions)
+	}
+	checkPaths(rc, []string{"b2_list_file_versions"}, t)
+}
+
+func testFileMetaJSON(id, name, sha1 string) string {
+	return fmt.Sprintf(`{"fileId":"%s","fileName":"%s","contentSha1":"%s","action":"upload"}`, id, name, sha1)
+}
+
+func testListJSON(files ...string) string {
+	return fmt.Sprintf(`{"files":[%s],"nextFileName":"","nextFileId":""}`, strings.Join(files, ","))
+}
+
+func testReplayClient(bodies ...string) *replayClient {
+	rc := &replayClient{}
+	for _, body := range bodies {
+		rc.Responses = append(rc.Responses, testResponse(200, body))
+	}
+	return rc
+}
+
+func checkPaths(rc *replayClient, expected []string, t *testing.T) {
+	paths := rc.paths()
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %d requests, instead got %v", len(expected), paths)
+	}
+	for i, p := range paths {
+		if !strings.HasSuffix(p, expected[i]) {
+			t.Errorf("Expected request %d to be %s, instead got %s", i, expected[i], p)
+		}
+	}
+}
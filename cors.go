@@ -0,0 +1,118 @@
+package b2
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CORSRule allows browsers from the AllowedOrigins to make the
+// AllowedOperations against a bucket.
+type CORSRule struct {
+	Name              string          `json:"corsRuleName"`
+	AllowedOrigins    []string        `json:"allowedOrigins"`
+	AllowedOperations []CORSOperation `json:"allowedOperations"`
+	AllowedHeaders    []string        `json:"allowedHeaders,omitempty"`
+	ExposeHeaders     []string        `json:"exposeHeaders,omitempty"`
+	MaxAgeSeconds     int64           `json:"maxAgeSeconds"`
+}
+
+// CORSOperation is an operation that a CORSRule may allow.
+type CORSOperation string
+
+// CORSOperations cover the native B2 download and upload calls, and their
+// S3 compatible equivalents.
+const (
+	CORSDownloadFileByName CORSOperation = "b2_download_file_by_name"
+	CORSDownloadFileByID   CORSOperation = "b2_download_file_by_id"
+	CORSUploadFile         CORSOperation = "b2_upload_file"
+	CORSUploadPart         CORSOperation = "b2_upload_part"
+	CORSS3Delete           CORSOperation = "s3_delete"
+	CORSS3Get              CORSOperation = "s3_get"
+	CORSS3Head             CORSOperation = "s3_head"
+	CORSS3Post             CORSOperation = "s3_post"
+	CORSS3Put              CORSOperation = "s3_put"
+)
+
+var corsOperations = map[CORSOperation]bool{
+	CORSDownloadFileByName: true,
+	CORSDownloadFileByID:   true,
+	CORSUploadFile:         true,
+	CORSUploadPart:         true,
+	CORSS3Delete:           true,
+	CORSS3Get:              true,
+	CORSS3Head:             true,
+	CORSS3Post:             true,
+	CORSS3Put:              true,
+}
+
+// corsRuleName is 6 to 50 letters, numbers and dashes.
+var corsRuleName = regexp.MustCompile(`^[A-Za-z0-9-]{6,50}$`)
+
+// corsOrigin is a scheme and host, with an optional port. The host may
+// contain a single "*" wildcard, which is checked separately.
+var corsOrigin = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://[A-Za-z0-9.*-]+(:[0-9]{1,5})?$`)
+
+// ValidateCORSRules checks a set of rules before they are sent to B2.
+//
+// Rule names must be unique, 6 to 50 letters, numbers and dashes, and may
+// not start with "b2-". Every rule needs at least one origin and one known
+// operation, and MaxAgeSeconds may be at most one day.
+func ValidateCORSRules(rules []CORSRule) error {
+	if len(rules) > 100 {
+		return fmt.Errorf("More than 100 CORS rules provided")
+	}
+	names := map[string]bool{}
+	for _, r := range rules {
+		if !corsRuleName.MatchString(r.Name) || strings.HasPrefix(r.Name, "b2-") {
+			return fmt.Errorf("Invalid CORS rule name %q", r.Name)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("Duplicate CORS rule name %q", r.Name)
+		}
+		names[r.Name] = true
+
+		if len(r.AllowedOrigins) == 0 {
+			return fmt.Errorf("CORS rule %q has no allowed origins", r.Name)
+		}
+		for _, o := range r.AllowedOrigins {
+			if err := validateCORSOrigin(o); err != nil {
+				return fmt.Errorf("CORS rule %q: %s", r.Name, err)
+			}
+		}
+
+		if len(r.AllowedOperations) == 0 {
+			return fmt.Errorf("CORS rule %q has no allowed operations", r.Name)
+		}
+		for _, op := range r.AllowedOperations {
+			if !corsOperations[op] {
+				return fmt.Errorf("CORS rule %q has unknown operation %q", r.Name, op)
+			}
+		}
+
+		for _, h := range r.AllowedHeaders {
+			if h == "" || strings.Count(h, "*") > 1 {
+				return fmt.Errorf("CORS rule %q has invalid allowed header %q", r.Name, h)
+			}
+		}
+		if r.MaxAgeSeconds < 0 || r.MaxAgeSeconds > 86400 {
+			return fmt.Errorf("CORS rule %q max age must be between 0 and 86400 seconds", r.Name)
+		}
+	}
+	return nil
+}
+
+// validateCORSOrigin checks that an origin is "*", or a scheme and host
+// with at most one "*" wildcard.
+func validateCORSOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("origin %q has more than one wildcard", origin)
+	}
+	if !corsOrigin.MatchString(origin) {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	return nil
+}
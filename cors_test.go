@@ -0,0 +1,71 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestValidateCORSRules(t *testing.T) {
+	good := func() CORSRule {
+		return CORSRule{
+			Name:              "downloadFromAnyOrigin",
+			AllowedOrigins:    []string{"https://*.example.com", "http://localhost:8080"},
+			AllowedOperations: []CORSOperation{CORSDownloadFileByName, CORSS3Get},
+			AllowedHeaders:    []string{"range", "x-bz-*"},
+			MaxAgeSeconds:     3600,
+		}
+	}
+
+	cases := map[string]struct {
+		modify func(r *CORSRule)
+		valid  bool
+	}{
+		"valid":          {modify: func(r *CORSRule) {}, valid: true},
+		"any origin":     {modify: func(r *CORSRule) { r.AllowedOrigins = []string{"*"} }, valid: true},
+		"short name":     {modify: func(r *CORSRule) { r.Name = "abc" }, valid: false},
+		"b2 name":        {modify: func(r *CORSRule) { r.Name = "b2-rule" }, valid: false},
+		"bad name chars": {modify: func(r *CORSRule) { r.Name = "my rule!" }, valid: false},
+		"no origins":     {modify: func(r *CORSRule) { r.AllowedOrigins = nil }, valid: false},
+		"two wildcards":  {modify: func(r *CORSRule) { r.AllowedOrigins = []string{"https://*.*.com"} }, valid: false},
+		"no scheme":      {modify: func(r *CORSRule) { r.AllowedOrigins = []string{"example.com"} }, valid: false},
+		"path":           {modify: func(r *CORSRule) { r.AllowedOrigins = []string{"https://example.com/x"} }, valid: false},
+		"no operations":  {modify: func(r *CORSRule) { r.AllowedOperations = nil }, valid: false},
+		"bad operation":  {modify: func(r *CORSRule) { r.AllowedOperations = []CORSOperation{"b2_delete_bucket"} }, valid: false},
+		"bad header":     {modify: func(r *CORSRule) { r.AllowedHeaders = []string{"**"} }, valid: false},
+		"max age":        {modify: func(r *CORSRule) { r.MaxAgeSeconds = 86401 }, valid: false},
+	}
+
+	for name, c := range cases {
+		rule := good()
+		c.modify(&rule)
+		err := ValidateCORSRules([]CORSRule{rule})
+		if c.valid && err != nil {
+			t.Errorf("Expected no error, instead got %s, case %s", err, name)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected an error, case %s", name)
+		}
+	}
+
+	if err := ValidateCORSRules([]CORSRule{good(), good()}); err == nil {
+		t.Error("Expected duplicate rule names to fail")
+	}
+}
+
+func TestBucket_UpdateWithOptions_cors(t *testing.T) {
+	bucket := testBucket()
+	opts := &BucketOptions{CORSRules: []CORSRule{{
+		Name:              "downloads",
+		AllowedOrigins:    []string{"*"},
+		AllowedOperations: []CORSOperation{CORSDownloadFileByName},
+	}}}
+	bucket.UpdateWithOptions("", opts)
+	req := bucket.B2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	expected := `"corsRules":[{"corsRuleName":"downloads","allowedOrigins":["*"],` +
+		`"allowedOperations":["b2_download_file_by_name"],"maxAgeSeconds":0}]`
+	if !bytes.Contains(body, []byte(expected)) {
+		t.Errorf("Expected %s in body, instead got %s", expected, body)
+	}
+}
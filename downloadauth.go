@@ -0,0 +1,145 @@
+package b2
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MaxDownloadAuthorization is the longest a download authorization may be
+// valid for.
+const MaxDownloadAuthorization = 7 * 24 * time.Hour
+
+// ResponseHeaders override the headers B2 sends with a downloaded file.
+// Empty fields are not overridden.
+type ResponseHeaders struct {
+	ContentDisposition string `json:"b2ContentDisposition,omitempty"`
+	ContentLanguage    string `json:"b2ContentLanguage,omitempty"`
+	Expires            string `json:"b2Expires,omitempty"`
+	CacheControl       string `json:"b2CacheControl,omitempty"`
+	ContentEncoding    string `json:"b2ContentEncoding,omitempty"`
+	ContentType        string `json:"b2ContentType,omitempty"`
+}
+
+// query returns the overrides as download query parameters.
+func (h *ResponseHeaders) query() url.Values {
+	q := url.Values{}
+	if h == nil {
+		return q
+	}
+	params := []struct{ key, value string }{
+		{"b2ContentDisposition", h.ContentDisposition},
+		{"b2ContentLanguage", h.ContentLanguage},
+		{"b2Expires", h.Expires},
+		{"b2CacheControl", h.CacheControl},
+		{"b2ContentEncoding", h.ContentEncoding},
+		{"b2ContentType", h.ContentType},
+	}
+	for _, p := range params {
+		if p.value != "" {
+			q.Set(p.key, p.value)
+		}
+	}
+	return q
+}
+
+// DownloadAuthorization allows the files in a private bucket that start
+// with FileNamePrefix to be downloaded without the account's token, until
+// Expiration.
+type DownloadAuthorization struct {
+	BucketID           string `json:"bucketId"`
+	FileNamePrefix     string `json:"fileNamePrefix"`
+	AuthorizationToken string `json:"authorizationToken"`
+
+	// ResponseHeaders are the overrides the authorization was created
+	// with. Downloads must request the same overrides.
+	ResponseHeaders *ResponseHeaders `json:"-"`
+	Expiration      time.Time        `json:"-"`
+}
+
+// downloadAuthorizationRequest is used for getting a download authorization.
+type downloadAuthorizationRequest struct {
+	BucketID               string `json:"bucketId"`
+	FileNamePrefix         string `json:"fileNamePrefix"`
+	ValidDurationInSeconds int64  `json:"validDurationInSeconds"`
+	*ResponseHeaders
+}
+
+// GetDownloadAuthorization gets a token that allows the files starting
+// with prefix to be downloaded for the valid duration, which must be
+// between one second and MaxDownloadAuthorization.
+//
+// If headers are given, downloads with the token must override the same
+// response headers, so they can't be changed by whoever has the token.
+func (b *Bucket) GetDownloadAuthorization(prefix string, valid time.Duration, headers *ResponseHeaders) (*DownloadAuthorization, error) {
+	if valid < time.Second || valid > MaxDownloadAuthorization {
+		return nil, fmt.Errorf("Valid duration must be between 1s and %s, not %s", MaxDownloadAuthorization, valid)
+	}
+
+	dar := downloadAuthorizationRequest{
+		BucketID:               b.ID,
+		FileNamePrefix:         prefix,
+		ValidDurationInSeconds: int64(valid / time.Second),
+		ResponseHeaders:        headers,
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_get_download_authorization", dar)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	da := &DownloadAuthorization{
+		ResponseHeaders: headers,
+		Expiration:      time.Now().UTC().Add(valid),
+	}
+	if err := parseResponse(resp, da); err != nil {
+		return nil, err
+	}
+	return da, nil
+}
+
+// AuthorizedURL returns a URL that downloads the named file with a download
+// authorization, which can be shared until the authorization expires.
+func (b *Bucket) AuthorizedURL(name string, auth *DownloadAuthorization) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("No file name provided")
+	}
+	if auth == nil {
+		return "", fmt.Errorf("No download authorization provided")
+	}
+	if !strings.HasPrefix(name, auth.FileNamePrefix) {
+		return "", fmt.Errorf("File %s doesn't start with the authorized prefix %s", name, auth.FileNamePrefix)
+	}
+
+	q := auth.ResponseHeaders.query()
+	q.Set("Authorization", auth.AuthorizationToken)
+	return b.fileURL(name) + "?" + q.Encode(), nil
+}
+
+// SignedURL returns a URL that downloads the named file for the valid
+// duration.
+//
+// B2 authorizes downloads by name prefix, so the URL's token authorizes
+// every file whose name begins with name: SignedURL("a") also authorizes
+// "a.bak" and "ab/secret". Use names that aren't the prefix of another file
+// when that matters.
+func (b *Bucket) SignedURL(name string, valid time.Duration, headers *ResponseHeaders) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("No file name provided")
+	}
+	auth, err := b.GetDownloadAuthorization(name, valid, headers)
+	if err != nil {
+		return "", err
+	}
+	return b.AuthorizedURL(name, auth)
+}
+
+// fileURL is the URL that downloads a file by name.
+func (b *Bucket) fileURL(name string) string {
+	return b.B2.DownloadURL + "/file/" + PercentEncode(b.Name) + "/" + PercentEncode(name)
+}
@@ -0,0 +1,83 @@
+package b2
+
+import (
+	"io/ioutil"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBucket_GetDownloadAuthorization(t *testing.T) {
+	bucket := testBucket()
+	for _, valid := range []time.Duration{0, time.Millisecond, MaxDownloadAuthorization + time.Second} {
+		if _, err := bucket.GetDownloadAuthorization("", valid, nil); err == nil {
+			t.Errorf("Expected a valid duration of %s to fail", valid)
+		}
+	}
+
+	_, err := bucket.GetDownloadAuthorization("dir/", time.Hour, &ResponseHeaders{ContentDisposition: "attachment"})
+	checkAPIError(err, 400, t)
+	req := bucket.B2.client.(*testClient).Request
+	if auth := req.Header.Get("Authorization"); auth != bucket.B2.AuthorizationToken {
+		t.Errorf("Expected auth to be %s, instead got %s", bucket.B2.AuthorizationToken, auth)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	expected := `{"bucketId":"id","fileNamePrefix":"dir/","validDurationInSeconds":3600,"b2ContentDisposition":"attachment"}`
+	if string(body) != expected {
+		t.Errorf("Expected body to be %s, instead got %s", expected, body)
+	}
+
+	bucket.GetDownloadAuthorization("", time.Minute, nil)
+	req = bucket.B2.client.(*testClient).Request
+	body, _ = ioutil.ReadAll(req.Body)
+	expected = `{"bucketId":"id","fileNamePrefix":"","validDurationInSeconds":60}`
+	if string(body) != expected {
+		t.Errorf("Expected body to be %s, instead got %s", expected, body)
+	}
+}
+
+func TestBucket_SignedURL(t *testing.T) {
+	rc := testReplayClient(`{"bucketId":"id","fileNamePrefix":"dir/cat pics.jpg","authorizationToken":"dl-token"}`)
+	bucket := testBucket()
+	bucket.B2.client = rc
+
+	headers := &ResponseHeaders{ContentDisposition: "attachment; filename=cat.jpg", CacheControl: "max-age=60"}
+	u, err := bucket.SignedURL("dir/cat pics.jpg", time.Hour, headers)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("Expected a valid URL, instead got %s", err)
+	}
+	if parsed.EscapedPath() != "/file/bucket/dir/cat%20pics.jpg" {
+		t.Errorf("Expected the escaped file path, instead got %s", parsed.EscapedPath())
+	}
+	q := parsed.Query()
+	if q.Get("Authorization") != "dl-token" {
+		t.Errorf("Expected the download token, instead got %s", q.Get("Authorization"))
+	}
+	if q.Get("b2ContentDisposition") != headers.ContentDisposition || q.Get("b2CacheControl") != headers.CacheControl {
+		t.Errorf("Expected the response header overrides, instead got %v", q)
+	}
+	checkPaths(rc, []string{"b2_get_download_authorization"}, t)
+}
+
+func TestBucket_AuthorizedURL(t *testing.T) {
+	bucket := testBucket()
+	auth := &DownloadAuthorization{FileNamePrefix: "public/", AuthorizationToken: "dl-token"}
+	if _, err := bucket.AuthorizedURL("private/file", auth); err == nil {
+		t.Error("Expected a file outside the prefix to fail")
+	}
+	if _, err := bucket.AuthorizedURL("public/file", nil); err == nil {
+		t.Error("Expected no authorization to fail")
+	}
+	u, err := bucket.AuthorizedURL("public/file", auth)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	expected := "https://f900.backblaze.com/file/bucket/public/file?Authorization=dl-token"
+	if u != expected {
+		t.Errorf("Expected %s, instead got %s", expected, u)
+	}
+}
@@ -0,0 +1,81 @@
+package b2
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// PercentEncode encodes a file name or file info value the way B2 expects it
+// in headers and URLs.
+//
+// The UTF-8 bytes of s are percent-encoded, except for letters, digits, and
+// "-", ".", "_", "~" and "/". Spaces become "%20" rather than "+", since B2
+// decodes "+" as a space.
+func PercentEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) || c == '/' {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+// PercentDecode decodes a file name or file info value sent by B2, undoing
+// PercentEncode. A "+" is decoded as a space, as B2 does.
+//
+// It returns an error if an escape is malformed or the result isn't valid
+// UTF-8.
+func PercentDecode(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '+':
+			sb.WriteByte(' ')
+		case '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", fmt.Errorf("Invalid percent-encoding in %q", s)
+			}
+			sb.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	if !utf8.ValidString(sb.String()) {
+		return "", fmt.Errorf("Percent-decoded %q is not valid UTF-8", s)
+	}
+	return sb.String(), nil
+}
+
+// decodeHeader decodes a header sent by B2, returning it unchanged if it
+// wasn't percent-encoded.
+func decodeHeader(v string) string {
+	if d, err := PercentDecode(v); err == nil {
+		return d
+	}
+	return v
+}
+
+func isUnreserved(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
@@ -0,0 +1,103 @@
+package b2
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testTrickyNames are file names that need careful encoding.
+var testTrickyNames = []string{
+	"plain.txt",
+	"dir/sub dir/file with spaces.txt",
+	"a+b=c&d?e#f%g.txt",
+	"ünïcödé/猫の写真.jpg",
+	"emoji 🐈‍⬛ cat.png",
+	"é combining.txt",
+	"semi;colon,comma:colon@at!bang$dollar'quote(paren)*star",
+	"~tilde_under-dash.dot",
+	`back\slash "quoted"`,
+	"%2F already encoded %20",
+}
+
+func TestPercentEncode(t *testing.T) {
+	cases := map[string]string{
+		"kitten.jpg":              "kitten.jpg",
+		"dir/cat pics.jpg":        "dir/cat%20pics.jpg",
+		"a+b":                     "a%2Bb",
+		"√":                       "%E2%88%9A",
+		"~_-.":                    "~_-.",
+		"100%":                    "100%25",
+		"semi;colon,comma&amp=eq": "semi%3Bcolon%2Ccomma%26amp%3Deq",
+	}
+	for in, expected := range cases {
+		if out := PercentEncode(in); out != expected {
+			t.Errorf("Expected %q to encode as %q, instead got %q", in, expected, out)
+		}
+	}
+}
+
+func TestPercentDecode(t *testing.T) {
+	cases := map[string]string{
+		"dir/cat%20pics.jpg": "dir/cat pics.jpg",
+		"cat+pics":           "cat pics",
+		"a%2Bb":              "a+b",
+		"%e2%88%9a":          "√",
+		"plain":              "plain",
+	}
+	for in, expected := range cases {
+		out, err := PercentDecode(in)
+		if err != nil || out != expected {
+			t.Errorf("Expected %q to decode as %q, instead got %q with %v", in, expected, out, err)
+		}
+	}
+	for _, bad := range []string{"%", "%2", "%zz", "%FF"} {
+		if _, err := PercentDecode(bad); err == nil {
+			t.Errorf("Expected %q to fail", bad)
+		}
+	}
+}
+
+func TestPercentEncode_roundTrip(t *testing.T) {
+	for _, name := range testTrickyNames {
+		encoded := PercentEncode(name)
+		for i := 0; i < len(encoded); i++ {
+			if c := encoded[i]; c != '%' && c != '/' && !isUnreserved(c) {
+				t.Errorf("Expected %q to be fully encoded, instead got %q", name, encoded)
+				break
+			}
+		}
+		decoded, err := PercentDecode(encoded)
+		if err != nil || decoded != name {
+			t.Errorf("Expected %q to round trip, instead got %q with %v", name, decoded, err)
+		}
+	}
+}
+
+func TestBucket_trickyNames(t *testing.T) {
+	bucket, _ := testFakeBucket()
+	for _, name := range testTrickyNames {
+		info := map[string]string{"note": name}
+		if _, err := bucket.UploadFile(name, bytes.NewReader([]byte(name)), info); err != nil {
+			t.Errorf("Expected %q to upload, instead got %s", name, err)
+			continue
+		}
+		f, err := bucket.DownloadFileByName(name)
+		if err != nil {
+			t.Errorf("Expected %q to download, instead got %s", name, err)
+			continue
+		}
+		if f.Meta.Name != name || f.Meta.FileInfo["note"] != name || string(f.Data) != name {
+			t.Errorf("Expected %q to round trip, instead got %+v", name, f.Meta)
+		}
+	}
+}
+
+func TestBucket_DownloadFileByName_url(t *testing.T) {
+	bucket := testBucket()
+	bucket.DownloadFileByName("dir/cat pics+1.jpg")
+	req := bucket.B2.client.(*testClient).Request
+	expected := "https://f900.backblaze.com/file/bucket/dir/cat%20pics%2B1.jpg"
+	if req.URL.String() != expected {
+		t.Errorf("Expected %s, instead got %s", expected, req.URL)
+	}
+}
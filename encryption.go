@@ -0,0 +1,156 @@
+package b2
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+// EncryptionMode is the kind of server-side encryption used for a file.
+type EncryptionMode string
+
+// Files may be unencrypted, encrypted with a key B2 manages (SSE-B2), or
+// encrypted with a key the customer provides with every request (SSE-C).
+const (
+	EncryptionNone  EncryptionMode = ""
+	EncryptionSSEB2 EncryptionMode = "SSE-B2"
+	EncryptionSSEC  EncryptionMode = "SSE-C"
+)
+
+// EncryptionAES256 is the only algorithm B2 supports.
+const EncryptionAES256 = "AES256"
+
+// Encryption is the server-side encryption settings of a file or bucket.
+//
+// CustomerKey and CustomerKeyMD5 are only used with SSE-C, and are base64
+// encoded. B2 never returns them.
+type Encryption struct {
+	Mode           EncryptionMode `json:"mode,omitempty"`
+	Algorithm      string         `json:"algorithm,omitempty"`
+	CustomerKey    string         `json:"customerKey,omitempty"`
+	CustomerKeyMD5 string         `json:"customerKeyMd5,omitempty"`
+}
+
+// BucketEncryption is the default encryption of a bucket, as B2 reports it.
+//
+// Value is nil if the application key isn't allowed to read it.
+type BucketEncryption struct {
+	IsClientAuthorizedToRead bool        `json:"isClientAuthorizedToRead"`
+	Value                    *Encryption `json:"value"`
+}
+
+// SSEB2 returns Encryption settings for a key managed by B2.
+func SSEB2() *Encryption {
+	return &Encryption{Mode: EncryptionSSEB2, Algorithm: EncryptionAES256}
+}
+
+// SSEC returns Encryption settings for a customer provided 256-bit key.
+//
+// The same key must be provided to download or copy the file.
+func SSEC(key []byte) (*Encryption, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("SSE-C key must be 32 bytes, not %d", len(key))
+	}
+	sum := md5.Sum(key)
+	return &Encryption{
+		Mode:           EncryptionSSEC,
+		Algorithm:      EncryptionAES256,
+		CustomerKey:    base64.StdEncoding.EncodeToString(key),
+		CustomerKeyMD5: base64.StdEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+// validate checks that the Encryption is complete for its mode.
+// A nil Encryption is valid and means the default is used.
+func (e *Encryption) validate() error {
+	if e == nil {
+		return nil
+	}
+	if e.Algorithm != "" && e.Algorithm != EncryptionAES256 {
+		return fmt.Errorf("Unknown encryption algorithm %s", e.Algorithm)
+	}
+
+	switch e.Mode {
+	case EncryptionNone, EncryptionSSEB2:
+		if e.CustomerKey != "" {
+			return fmt.Errorf("A customer key is only used with SSE-C")
+		}
+		return nil
+	case EncryptionSSEC:
+		key, err := base64.StdEncoding.DecodeString(e.CustomerKey)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("SSE-C customer key must be a base64 encoded 32 byte key")
+		}
+		sum := md5.Sum(key)
+		if e.CustomerKeyMD5 != "" && e.CustomerKeyMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+			return fmt.Errorf("SSE-C customer key md5 doesn't match the key")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unknown encryption mode %s", e.Mode)
+	}
+}
+
+// withDefaults fills in the algorithm and, for SSE-C, the key md5.
+func (e *Encryption) withDefaults() *Encryption {
+	if e == nil {
+		return nil
+	}
+	out := *e
+	if out.Mode != EncryptionNone && out.Algorithm == "" {
+		out.Algorithm = EncryptionAES256
+	}
+	if out.Mode == EncryptionSSEC && out.CustomerKeyMD5 == "" {
+		key, _ := base64.StdEncoding.DecodeString(out.CustomerKey)
+		sum := md5.Sum(key)
+		out.CustomerKeyMD5 = base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return &out
+}
+
+// setUploadHeaders sets the headers that encrypt an uploaded file or part.
+func (e *Encryption) setUploadHeaders(h http.Header) {
+	e = e.withDefaults()
+	if e == nil {
+		return
+	}
+	switch e.Mode {
+	case EncryptionSSEB2:
+		h.Set("X-Bz-Server-Side-Encryption", e.Algorithm)
+	case EncryptionSSEC:
+		e.setCustomerKeyHeaders(h)
+	}
+}
+
+// setDownloadHeaders sets the headers needed to download an SSE-C file.
+// Files encrypted with SSE-B2 need no headers to be downloaded.
+func (e *Encryption) setDownloadHeaders(h http.Header) {
+	e = e.withDefaults()
+	if e == nil || e.Mode != EncryptionSSEC {
+		return
+	}
+	e.setCustomerKeyHeaders(h)
+}
+
+func (e *Encryption) setCustomerKeyHeaders(h http.Header) {
+	h.Set("X-Bz-Server-Side-Encryption-Customer-Algorithm", e.Algorithm)
+	h.Set("X-Bz-Server-Side-Encryption-Customer-Key", e.CustomerKey)
+	h.Set("X-Bz-Server-Side-Encryption-Customer-Key-Md5", e.CustomerKeyMD5)
+}
+
+// encryptionFromHeaders returns the encryption that a download response
+// reports, or nil if the file isn't encrypted.
+func encryptionFromHeaders(h http.Header) *Encryption {
+	if alg := h.Get("X-Bz-Server-Side-Encryption"); alg != "" {
+		return &Encryption{Mode: EncryptionSSEB2, Algorithm: alg}
+	}
+	if alg := h.Get("X-Bz-Server-Side-Encryption-Customer-Algorithm"); alg != "" {
+		return &Encryption{
+			Mode:           EncryptionSSEC,
+			Algorithm:      alg,
+			CustomerKeyMD5: h.Get("X-Bz-Server-Side-Encryption-Customer-Key-Md5"),
+		}
+	}
+	return nil
+}
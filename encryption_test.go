@@ -0,0 +1,199 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestSSEC(t *testing.T) {
+	if _, err := SSEC([]byte("short")); err == nil {
+		t.Error("Expected a short key to fail")
+	}
+
+	e, err := SSEC(testSSECKey())
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if e.Mode != EncryptionSSEC || e.Algorithm != EncryptionAES256 {
+		t.Errorf("Expected SSE-C with AES256, instead got %+v", e)
+	}
+	if e.CustomerKeyMD5 == "" {
+		t.Error("Expected the key md5 to be set")
+	}
+	if err := e.validate(); err != nil {
+		t.Errorf("Expected no error, instead got %s", err)
+	}
+}
+
+func TestEncryption_validate(t *testing.T) {
+	ssec, _ := SSEC(testSSECKey())
+	badMD5 := *ssec
+	badMD5.CustomerKeyMD5 = "AAAA"
+	cases := map[string]struct {
+		e     *Encryption
+		valid bool
+	}{
+		"nil":           {e: nil, valid: true},
+		"none":          {e: &Encryption{}, valid: true},
+		"sse-b2":        {e: SSEB2(), valid: true},
+		"sse-c":         {e: ssec, valid: true},
+		"bad mode":      {e: &Encryption{Mode: "SSE-X"}, valid: false},
+		"bad algorithm": {e: &Encryption{Mode: EncryptionSSEB2, Algorithm: "DES"}, valid: false},
+		"sse-b2 key":    {e: &Encryption{Mode: EncryptionSSEB2, CustomerKey: ssec.CustomerKey}, valid: false},
+		"sse-c no key":  {e: &Encryption{Mode: EncryptionSSEC}, valid: false},
+		"sse-c bad md5": {e: &badMD5, valid: false},
+	}
+	for name, c := range cases {
+		err := c.e.validate()
+		if c.valid && err != nil {
+			t.Errorf("Expected no error, instead got %s, case %s", err, name)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected an error, case %s", name)
+		}
+	}
+}
+
+func TestEncryption_headers(t *testing.T) {
+	h := http.Header{}
+	SSEB2().setUploadHeaders(h)
+	if h.Get("X-Bz-Server-Side-Encryption") != "AES256" {
+		t.Errorf("Expected SSE-B2 upload header, instead got %+v", h)
+	}
+	h = http.Header{}
+	SSEB2().setDownloadHeaders(h)
+	if len(h) != 0 {
+		t.Errorf("Expected no SSE-B2 download headers, instead got %+v", h)
+	}
+
+	// the md5 is filled in when only the key is given
+	ssec, _ := SSEC(testSSECKey())
+	e := &Encryption{Mode: EncryptionSSEC, CustomerKey: ssec.CustomerKey}
+	for _, set := range []func(http.Header){e.setUploadHeaders, e.setDownloadHeaders} {
+		h = http.Header{}
+		set(h)
+		if h.Get("X-Bz-Server-Side-Encryption-Customer-Algorithm") != "AES256" ||
+			h.Get("X-Bz-Server-Side-Encryption-Customer-Key") != ssec.CustomerKey ||
+			h.Get("X-Bz-Server-Side-Encryption-Customer-Key-Md5") != ssec.CustomerKeyMD5 {
+			t.Errorf("Expected SSE-C headers, instead got %+v", h)
+		}
+	}
+}
+
+func TestEncryptionFromHeaders(t *testing.T) {
+	if e := encryptionFromHeaders(http.Header{}); e != nil {
+		t.Errorf("Expected no encryption, instead got %+v", e)
+	}
+	e := encryptionFromHeaders(http.Header{"X-Bz-Server-Side-Encryption": {"AES256"}})
+	if e == nil || e.Mode != EncryptionSSEB2 {
+		t.Errorf("Expected SSE-B2, instead got %+v", e)
+	}
+	e = encryptionFromHeaders(http.Header{
+		"X-Bz-Server-Side-Encryption-Customer-Algorithm": {"AES256"},
+		"X-Bz-Server-Side-Encryption-Customer-Key-Md5":   {"md5"},
+	})
+	if e == nil || e.Mode != EncryptionSSEC || e.CustomerKeyMD5 != "md5" {
+		t.Errorf("Expected SSE-C, instead got %+v", e)
+	}
+}
+
+func TestBucket_UploadFileWithOptions_encryption(t *testing.T) {
+	bucket := testBucket()
+	bucket.UploadURLs = []*UploadURL{testUploadURL()}
+	ssec, _ := SSEC(testSSECKey())
+
+	req, err := bucket.setupUploadFile("name", bytes.NewReader([]byte("cats")), &UploadOptions{Encryption: ssec})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if req.Header.Get("X-Bz-Server-Side-Encryption-Customer-Key") != ssec.CustomerKey {
+		t.Errorf("Expected SSE-C key header, instead got %+v", req.Header)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != "cats" {
+		t.Errorf(`Expected body to be "cats", instead got %s`, body)
+	}
+
+	fm, err := bucket.UploadFileWithOptions("name", bytes.NewReader([]byte("cats")),
+		&UploadOptions{Encryption: &Encryption{Mode: EncryptionSSEC}})
+	if err == nil {
+		t.Error("Expected SSE-C without a key to fail")
+	}
+	if fm != nil {
+		t.Errorf("Expected fm to be nil, instead got %+v", fm)
+	}
+}
+
+func TestBucket_DownloadFileByNameWithOptions_encryption(t *testing.T) {
+	bucket := testBucket()
+	ssec, _ := SSEC(testSSECKey())
+	bucket.DownloadFileByNameWithOptions("name", &DownloadOptions{Encryption: ssec})
+	req := bucket.B2.client.(*testClient).Request
+	if req.Header.Get("X-Bz-Server-Side-Encryption-Customer-Key-Md5") != ssec.CustomerKeyMD5 {
+		t.Errorf("Expected SSE-C key md5 header, instead got %+v", req.Header)
+	}
+
+	headers := map[string][]string{
+		"X-Bz-File-Id":                {"1"},
+		"X-Bz-File-Name":              {"cats.txt"},
+		"Content-Length":              {"19"},
+		"X-Bz-Content-Sha1":           {"78498e5096b20e3f1c063e8740ff83d595ededb3"},
+		"X-Bz-Server-Side-Encryption": {"AES256"},
+	}
+	resp := testResponse(200, "cats cats cats cats")
+	resp.Header = headers
+	file, err := bucket.parseFile(resp)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if file.Meta.Encryption == nil || file.Meta.Encryption.Mode != EncryptionSSEB2 {
+		t.Errorf("Expected SSE-B2 encryption, instead got %+v", file.Meta.Encryption)
+	}
+}
+
+func TestBucket_CopyFileWithOptions_encryption(t *testing.T) {
+	bucket := testBucket()
+	ssec, _ := SSEC(testSSECKey())
+	bucket.CopyFileWithOptions("id", "name", nil, &CopyOptions{SourceEncryption: ssec, DestinationEncryption: SSEB2()})
+	req := bucket.B2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	for _, field := range []string{
+		`"sourceServerSideEncryption":{"mode":"SSE-C","algorithm":"AES256","customerKey":"` + ssec.CustomerKey,
+		`"destinationServerSideEncryption":{"mode":"SSE-B2","algorithm":"AES256"}`,
+	} {
+		if !bytes.Contains(body, []byte(field)) {
+			t.Errorf("Expected %s in body, instead got %s", field, body)
+		}
+	}
+}
+
+func TestB2_CreateBucketWithOptions_encryption(t *testing.T) {
+	b2 := testB2()
+	ssec, _ := SSEC(testSSECKey())
+	if _, err := b2.CreateBucketWithOptions("name", AllPrivate, &BucketOptions{DefaultEncryption: ssec}); err == nil {
+		t.Error("Expected SSE-C as a bucket default to fail")
+	}
+
+	b2.CreateBucketWithOptions("name", AllPrivate, &BucketOptions{DefaultEncryption: SSEB2()})
+	req := b2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	if !bytes.Contains(body, []byte(`"defaultServerSideEncryption":{"mode":"SSE-B2","algorithm":"AES256"}`)) {
+		t.Errorf("Expected default encryption in body, instead got %s", body)
+	}
+
+	resp := testResponse(200, `{"bucketId":"id","bucketName":"name","bucketType":"allPrivate",`+
+		`"defaultServerSideEncryption":{"isClientAuthorizedToRead":true,"value":{"algorithm":"AES256","mode":"SSE-B2"}}}`)
+	bucket, err := b2.parseCreateBucket(resp)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if bucket.DefaultEncryption == nil || bucket.DefaultEncryption.Value.Mode != EncryptionSSEB2 {
+		t.Errorf("Expected SSE-B2 default encryption, instead got %+v", bucket.DefaultEncryption)
+	}
+}
+
+func testSSECKey() []byte {
+	return []byte("0123456789abcdef0123456789abcdef")
+}
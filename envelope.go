@@ -0,0 +1,401 @@
+package b2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The fileInfo keys used to store the parameters of a client-side
+// encrypted file. They count towards the 10 key limit of an upload.
+const (
+	envelopeSchemeKey = "enc_scheme"
+	envelopeKeyKey    = "enc_key"
+	envelopeNonceKey  = "enc_nonce"
+	envelopeChunkKey  = "enc_chunk"
+)
+
+// envelopeScheme identifies the format of a client-side encrypted file: the
+// plaintext split into chunks, each sealed with AES-256-GCM.
+const envelopeScheme = "aes256gcm-chunked-v1"
+
+// DefaultEnvelopeChunkSize is the plaintext size of each encrypted chunk
+// when an EncryptedBucket has no ChunkSize.
+const DefaultEnvelopeChunkSize = 64 * 1024
+
+// KeyWrapper encrypts and decrypts the per-file data keys of an
+// EncryptedBucket. It holds the key-encryption key, which never leaves the
+// client.
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// aesKeyWrapper wraps data keys with AES-256-GCM.
+type aesKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewAESKeyWrapper returns a KeyWrapper that wraps data keys with the given
+// 32 byte key-encryption key, using AES-256-GCM.
+func NewAESKeyWrapper(kek []byte) (KeyWrapper, error) {
+	if len(kek) != 32 {
+		return nil, fmt.Errorf("Key-encryption key must be 32 bytes, not %d", len(kek))
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	return &aesKeyWrapper{aead: aead}, nil
+}
+
+// WrapKey seals the data key behind a random nonce, which is prepended.
+func (w *aesKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, dataKey, []byte(envelopeScheme)), nil
+}
+
+// UnwrapKey opens a key sealed by WrapKey.
+func (w *aesKeyWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	n := w.aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, fmt.Errorf("Wrapped key is too short")
+	}
+	return w.aead.Open(nil, wrapped[:n], wrapped[n:], []byte(envelopeScheme))
+}
+
+// EncryptedBucket encrypts files on the client before they are uploaded to
+// Bucket, and decrypts them after they are downloaded, so B2 only ever sees
+// ciphertext.
+//
+// Every file gets its own random data key, which is wrapped by Keys and
+// stored with the nonce and chunk size in the file's fileInfo.
+type EncryptedBucket struct {
+	Bucket    *Bucket
+	Keys      KeyWrapper
+	ChunkSize int
+}
+
+// NewEncryptedBucket wraps a Bucket with client-side encryption.
+func NewEncryptedBucket(b *Bucket, keys KeyWrapper) *EncryptedBucket {
+	return &EncryptedBucket{Bucket: b, Keys: keys, ChunkSize: DefaultEnvelopeChunkSize}
+}
+
+// UploadFile encrypts and uploads a file.
+//
+// Four fileInfo keys are used by the encryption, so at most 6 may be given.
+func (eb *EncryptedBucket) UploadFile(name string, file io.Reader, fileInfo map[string]string) (*FileMeta, error) {
+	return eb.UploadFileWithOptions(name, file, &UploadOptions{FileInfo: fileInfo})
+}
+
+// UploadFileWithOptions encrypts and uploads a file with the given options.
+func (eb *EncryptedBucket) UploadFileWithOptions(name string, file io.Reader, opts *UploadOptions) (*FileMeta, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	if file == nil {
+		return nil, fmt.Errorf("No file data provided")
+	}
+	if len(opts.fileInfo()) > 10-4 {
+		return nil, fmt.Errorf("More than 6 file info keys provided to an encrypted upload")
+	}
+
+	dataKey := make([]byte, 32)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	wrapped, err := eb.Keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encOpts := *opts
+	encOpts.FileInfo = map[string]string{}
+	for k, v := range opts.FileInfo {
+		encOpts.FileInfo[k] = v
+	}
+	chunkSize := eb.chunkSize()
+	encOpts.FileInfo[envelopeSchemeKey] = envelopeScheme
+	encOpts.FileInfo[envelopeKeyKey] = base64.StdEncoding.EncodeToString(wrapped)
+	encOpts.FileInfo[envelopeNonceKey] = base64.StdEncoding.EncodeToString(nonce)
+	encOpts.FileInfo[envelopeChunkKey] = strconv.Itoa(chunkSize)
+
+	enc := &chunkEncrypter{r: file, aead: aead, nonce: nonce, chunkSize: chunkSize}
+	return eb.Bucket.UploadFileWithOptions(name, enc, &encOpts)
+}
+
+// DownloadFileByName downloads and decrypts a file given its name.
+func (eb *EncryptedBucket) DownloadFileByName(name string) (*File, error) {
+	return eb.DownloadFileByNameWithOptions(name, nil)
+}
+
+// DownloadFileByNameWithOptions downloads and decrypts a file given its name
+// and download options. Any Range is of the decrypted file.
+func (eb *EncryptedBucket) DownloadFileByNameWithOptions(name string, opts *DownloadOptions) (*File, error) {
+	return eb.download(func(o *DownloadOptions) (*File, error) {
+		return eb.Bucket.DownloadFileByNameWithOptions(name, o)
+	}, opts)
+}
+
+// DownloadFileByID downloads and decrypts a file given its ID.
+func (eb *EncryptedBucket) DownloadFileByID(id string) (*File, error) {
+	return eb.DownloadFileByIDWithOptions(id, nil)
+}
+
+// DownloadFileByIDWithOptions downloads and decrypts a file given its ID
+// and download options. Any Range is of the decrypted file.
+func (eb *EncryptedBucket) DownloadFileByIDWithOptions(id string, opts *DownloadOptions) (*File, error) {
+	return eb.download(func(o *DownloadOptions) (*File, error) {
+		return eb.Bucket.DownloadFileByIDWithOptions(id, o)
+	}, opts)
+}
+
+// download fetches the chunks covering the requested range and decrypts
+// them.
+//
+// A ranged download assumes the file uses this EncryptedBucket's chunk size.
+// If the file says otherwise, the range is fetched again.
+func (eb *EncryptedBucket) download(get func(*DownloadOptions) (*File, error), opts *DownloadOptions) (*File, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	plainRange := opts.Range
+	chunkSize := eb.chunkSize()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		o := *opts
+		if plainRange != nil {
+			o.Range = envelopeCipherRange(*plainRange, chunkSize)
+		}
+		f, err := get(&o)
+		if err != nil {
+			return nil, err
+		}
+		p, err := envelopeParamsFromInfo(f.Meta.FileInfo)
+		if err != nil {
+			return nil, err
+		}
+		if plainRange != nil && p.chunkSize != chunkSize {
+			chunkSize = p.chunkSize
+			continue
+		}
+		return eb.decrypt(f, p, plainRange)
+	}
+	return nil, fmt.Errorf("File chunk size changed during download")
+}
+
+// decrypt opens the chunks of a downloaded File and returns the plaintext
+// File, trimmed to the requested range.
+func (eb *EncryptedBucket) decrypt(f *File, p *envelopeParams, plainRange *ByteRange) (*File, error) {
+	dataKey, err := eb.Keys.UnwrapKey(p.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedSize := int64(p.chunkSize + aead.Overhead())
+	chunks := (f.Meta.Size + sealedSize - 1) / sealedSize
+	if chunks == 0 {
+		return nil, fmt.Errorf("Encrypted file is empty")
+	}
+	plainSize := f.Meta.Size - chunks*int64(aead.Overhead())
+
+	first := int64(0)
+	if plainRange != nil {
+		if plainRange.Start >= plainSize && plainSize > 0 {
+			return nil, fmt.Errorf("Range starts beyond the end of the file")
+		}
+		first = plainRange.Start / int64(p.chunkSize)
+	}
+
+	plain := []byte{}
+	data := f.Data
+	for i := first; len(data) > 0; i++ {
+		n := int(sealedSize)
+		if len(data) < n {
+			n = len(data)
+		}
+		out, err := aead.Open(nil, chunkNonce(p.nonce, uint64(i)), data[:n], chunkAAD(uint64(i), i == chunks-1))
+		if err != nil {
+			return nil, fmt.Errorf("Decrypting chunk %d: %s", i, err)
+		}
+		plain = append(plain, out...)
+		data = data[n:]
+	}
+
+	if plainRange != nil {
+		start := plainRange.Start - first*int64(p.chunkSize)
+		end := plainRange.End - first*int64(p.chunkSize) + 1
+		if end > int64(len(plain)) {
+			end = int64(len(plain))
+		}
+		if start > end {
+			start = end
+		}
+		plain = plain[start:end]
+	}
+
+	info := map[string]string{}
+	for k, v := range f.Meta.FileInfo {
+		switch k {
+		case envelopeSchemeKey, envelopeKeyKey, envelopeNonceKey, envelopeChunkKey:
+		default:
+			info[k] = v
+		}
+	}
+	meta := f.Meta
+	meta.Size = plainSize
+	meta.ContentLength = int64(len(plain))
+	meta.FileInfo = info
+	return &File{Meta: meta, Data: plain}, nil
+}
+
+func (eb *EncryptedBucket) chunkSize() int {
+	if eb.ChunkSize <= 0 {
+		return DefaultEnvelopeChunkSize
+	}
+	return eb.ChunkSize
+}
+
+// envelopeParams are the encryption parameters stored in a file's fileInfo.
+type envelopeParams struct {
+	wrappedKey []byte
+	nonce      []byte
+	chunkSize  int
+}
+
+func envelopeParamsFromInfo(info map[string]string) (*envelopeParams, error) {
+	if info[envelopeSchemeKey] != envelopeScheme {
+		return nil, fmt.Errorf("File is not client-side encrypted, or uses an unknown scheme %q", info[envelopeSchemeKey])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(info[envelopeKeyKey])
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(info[envelopeNonceKey])
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != 12 {
+		return nil, fmt.Errorf("Invalid encryption nonce")
+	}
+	chunkSize, err := strconv.Atoi(info[envelopeChunkKey])
+	if err != nil || chunkSize <= 0 {
+		return nil, fmt.Errorf("Invalid encryption chunk size %q", info[envelopeChunkKey])
+	}
+	return &envelopeParams{wrappedKey: wrapped, nonce: nonce, chunkSize: chunkSize}, nil
+}
+
+// envelopeCipherRange returns the range of ciphertext holding every chunk
+// that overlaps a range of plaintext.
+func envelopeCipherRange(r ByteRange, chunkSize int) *ByteRange {
+	sealed := int64(chunkSize + 16)
+	first := r.Start / int64(chunkSize)
+	last := r.End / int64(chunkSize)
+	return &ByteRange{Start: first * sealed, End: (last+1)*sealed - 1}
+}
+
+// chunkEncrypter is an io.Reader of the sealed chunks of its plaintext
+// reader. Only one chunk is held in memory at a time.
+type chunkEncrypter struct {
+	r         io.Reader
+	aead      cipher.AEAD
+	nonce     []byte
+	chunkSize int
+	index     uint64
+	plain     []byte
+	out       []byte
+	done      bool
+}
+
+func (ce *chunkEncrypter) Read(p []byte) (int, error) {
+	for len(ce.out) == 0 {
+		if ce.done {
+			return 0, io.EOF
+		}
+		if err := ce.sealNext(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, ce.out)
+	ce.out = ce.out[n:]
+	return n, nil
+}
+
+// sealNext reads one more byte than a chunk, so that it knows whether the
+// chunk is the last one, and seals the chunk.
+func (ce *chunkEncrypter) sealNext() error {
+	if ce.plain == nil {
+		ce.plain = make([]byte, 0, ce.chunkSize+1)
+	}
+	have := len(ce.plain)
+	n, err := io.ReadFull(ce.r, ce.plain[have:ce.chunkSize+1])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	ce.plain = ce.plain[:have+n]
+
+	final := len(ce.plain) <= ce.chunkSize
+	chunk := ce.plain
+	if !final {
+		chunk = ce.plain[:ce.chunkSize]
+	}
+	ce.out = ce.aead.Seal(nil, chunkNonce(ce.nonce, ce.index), chunk, chunkAAD(ce.index, final))
+	ce.index++
+
+	if final {
+		ce.done = true
+		ce.plain = ce.plain[:0]
+	} else {
+		ce.plain = append(ce.plain[:0], ce.plain[ce.chunkSize])
+	}
+	return nil
+}
+
+// chunkNonce is the file's nonce with the chunk index xored into its last
+// eight bytes.
+func chunkNonce(nonce []byte, index uint64) []byte {
+	out := make([]byte, len(nonce))
+	copy(out, nonce)
+	tail := binary.BigEndian.Uint64(out[len(out)-8:])
+	binary.BigEndian.PutUint64(out[len(out)-8:], tail^index)
+	return out
+}
+
+// chunkAAD binds a chunk to its position, and marks the last chunk so that a
+// truncated file fails to decrypt.
+func chunkAAD(index uint64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, index)
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,214 @@
+package b2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewAESKeyWrapper(t *testing.T) {
+	if _, err := NewAESKeyWrapper([]byte("short")); err == nil {
+		t.Error("Expected a short key-encryption key to fail")
+	}
+
+	w, err := NewAESKeyWrapper(testSSECKey())
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	dataKey := []byte("data key data key data key 12345")
+	wrapped, err := w.WrapKey(dataKey)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("Expected the wrapped key not to contain the data key")
+	}
+	unwrapped, err := w.UnwrapKey(wrapped)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("Expected %s, instead got %s", dataKey, unwrapped)
+	}
+
+	other, _ := NewAESKeyWrapper([]byte("another key another key another "))
+	if _, err := other.UnwrapKey(wrapped); err == nil {
+		t.Error("Expected unwrapping with the wrong key to fail")
+	}
+}
+
+func TestEncryptedBucket_roundTrip(t *testing.T) {
+	sizes := []int{0, 1, 15, 16, 17, 48, 100}
+	for _, size := range sizes {
+		plain := testPlaintext(size)
+		eb, stored := testEncryptedUpload(t, plain, map[string]string{"owner": "ops"})
+		// short plaintexts may appear in the ciphertext by chance
+		if bytes.Contains(stored.data, plain) && size >= 8 {
+			t.Errorf("Expected uploaded data to be encrypted, size %d", size)
+		}
+
+		eb.Bucket.B2.client = &testReplayClientFunc{fn: stored.respond}
+		f, err := eb.DownloadFileByName("name")
+		if err != nil {
+			t.Fatalf("Expected no error, instead got %s, size %d", err, size)
+		}
+		if !bytes.Equal(f.Data, plain) {
+			t.Errorf("Expected %q, instead got %q", plain, f.Data)
+		}
+		if f.Meta.Size != int64(size) {
+			t.Errorf("Expected size to be %d, instead got %d", size, f.Meta.Size)
+		}
+		if len(f.Meta.FileInfo) != 1 || f.Meta.FileInfo["owner"] != "ops" {
+			t.Errorf("Expected only the caller's file info, instead got %+v", f.Meta.FileInfo)
+		}
+	}
+}
+
+func TestEncryptedBucket_rangedRead(t *testing.T) {
+	plain := testPlaintext(100)
+	eb, stored := testEncryptedUpload(t, plain, nil)
+	eb.Bucket.B2.client = &testReplayClientFunc{fn: stored.respond}
+
+	ranges := []ByteRange{{0, 0}, {0, 15}, {15, 16}, {20, 40}, {95, 99}, {90, 200}}
+	for _, r := range ranges {
+		r := r
+		f, err := eb.DownloadFileByIDWithOptions("id", &DownloadOptions{Range: &r})
+		if err != nil {
+			t.Fatalf("Expected no error, instead got %s, range %+v", err, r)
+		}
+		end := r.End + 1
+		if end > int64(len(plain)) {
+			end = int64(len(plain))
+		}
+		if !bytes.Equal(f.Data, plain[r.Start:end]) {
+			t.Errorf("Expected %q, instead got %q, range %+v", plain[r.Start:end], f.Data, r)
+		}
+		if f.Meta.Size != 100 {
+			t.Errorf("Expected size to be 100, instead got %d", f.Meta.Size)
+		}
+	}
+
+	// a reader with a different chunk size refetches with the file's
+	eb.ChunkSize = 7
+	r := ByteRange{Start: 30, End: 34}
+	f, err := eb.DownloadFileByNameWithOptions("name", &DownloadOptions{Range: &r})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if !bytes.Equal(f.Data, plain[30:35]) {
+		t.Errorf("Expected %q, instead got %q", plain[30:35], f.Data)
+	}
+}
+
+func TestEncryptedBucket_tampering(t *testing.T) {
+	plain := testPlaintext(40)
+	eb, stored := testEncryptedUpload(t, plain, nil)
+
+	// dropping the last chunk must be detected
+	truncated := *stored
+	truncated.data = stored.data[:2*(16+16)]
+	eb.Bucket.B2.client = &testReplayClientFunc{fn: truncated.respond}
+	if _, err := eb.DownloadFileByName("name"); err == nil {
+		t.Error("Expected a truncated file to fail to decrypt")
+	}
+
+	flipped := *stored
+	flipped.data = append([]byte{}, stored.data...)
+	flipped.data[3] ^= 1
+	eb.Bucket.B2.client = &testReplayClientFunc{fn: flipped.respond}
+	if _, err := eb.DownloadFileByName("name"); err == nil {
+		t.Error("Expected a modified file to fail to decrypt")
+	}
+}
+
+func TestEncryptedBucket_UploadFile(t *testing.T) {
+	keys, _ := NewAESKeyWrapper(testSSECKey())
+	eb := NewEncryptedBucket(testBucket(), keys)
+	info := map[string]string{"1": "", "2": "", "3": "", "4": "", "5": "", "6": "", "7": ""}
+	fm, err := eb.UploadFile("name", bytes.NewReader([]byte("cats")), info)
+	if err == nil {
+		t.Error("Expected more than 6 file info keys to fail")
+	}
+	if fm != nil {
+		t.Errorf("Expected fm to be nil, instead got %+v", fm)
+	}
+}
+
+// testStoredFile is an encrypted upload, which can be served back as a
+// download.
+type testStoredFile struct {
+	data    []byte
+	headers http.Header
+}
+
+// respond serves the stored file, honoring a Range request header.
+func (sf *testStoredFile) respond(req *http.Request) *http.Response {
+	data := sf.data
+	status := 200
+	resp := testResponse(status, "")
+	resp.Header = http.Header{}
+	for k, v := range sf.headers {
+		resp.Header[k] = v
+	}
+	if rng := req.Header.Get("Range"); rng != "" {
+		var start, end int
+		fmt.Sscanf(rng, "bytes=%d-%d", &start, &end)
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		resp.StatusCode = 206
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+	}
+	resp.Header.Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return resp
+}
+
+// testReplayClientFunc answers every request with fn.
+type testReplayClientFunc struct {
+	fn func(*http.Request) *http.Response
+}
+
+func (c *testReplayClientFunc) Do(r *http.Request) (*http.Response, error) {
+	return c.fn(r), nil
+}
+
+func testEncryptedUpload(t *testing.T, plain []byte, info map[string]string) (*EncryptedBucket, *testStoredFile) {
+	keys, _ := NewAESKeyWrapper(testSSECKey())
+	bucket := testBucket()
+	bucket.UploadURLs = []*UploadURL{testUploadURL()}
+	rc := testReplayClient(testFileMetaJSON("id", "name", "sha1"))
+	bucket.B2.client = rc
+	eb := NewEncryptedBucket(bucket, keys)
+	eb.ChunkSize = 16
+
+	if _, err := eb.UploadFile("name", bytes.NewReader(plain), info); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	req := rc.Requests[0]
+	data, _ := ioutil.ReadAll(req.Body)
+	headers := http.Header{
+		"X-Bz-File-Id":      {"id"},
+		"X-Bz-File-Name":    {"name"},
+		"X-Bz-Content-Sha1": {fmt.Sprintf("%x", sha1.Sum(data))},
+	}
+	for k, v := range req.Header {
+		if strings.HasPrefix(k, "X-Bz-Info-") {
+			headers[k] = v
+		}
+	}
+	return eb, &testStoredFile{data: data, headers: headers}
+}
+
+func testPlaintext(size int) []byte {
+	out := make([]byte, size)
+	for i := range out {
+		out[i] = byte('a' + i%26)
+	}
+	return out
+}
@@ -0,0 +1,426 @@
+package b2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fakeB2 is an in-memory B2 account, used as the client of tests that
+// need several requests to agree with each other.
+type fakeB2 struct {
+	mu       sync.Mutex
+	versions []*fakeVersion
+	large    map[string]*fakeLargeFile
+	nextID   int
+	clock    int64
+	requests []*http.Request
+}
+
+// fakeVersion is one version of a file stored in a fakeB2.
+type fakeVersion struct {
+	bucketID string
+	meta     FileMeta
+	data     []byte
+}
+
+// fakeLargeFile is an unfinished large file stored in a fakeB2.
+type fakeLargeFile struct {
+	bucketID string
+	name     string
+	info     map[string]string
+	parts    map[int][]byte
+}
+
+func newFakeB2() *fakeB2 {
+	return &fakeB2{clock: 1000, large: map[string]*fakeLargeFile{}}
+}
+
+// testFakeBucket returns a Bucket backed by a new fakeB2.
+func testFakeBucket() (*Bucket, *fakeB2) {
+	fake := newFakeB2()
+	bucket := testBucket()
+	bucket.B2.client = fake
+	return bucket, fake
+}
+
+// put stores a new version of a file directly, returning its FileMeta.
+func (f *fakeB2) put(bucketID, name string, data []byte, info map[string]string) FileMeta {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.add(bucketID, name, ActionUpload, data, info)
+}
+
+func (f *fakeB2) add(bucketID, name string, action Action, data []byte, info map[string]string) FileMeta {
+	f.nextID++
+	f.clock++
+	if info == nil {
+		info = map[string]string{}
+	}
+	sum := fmt.Sprintf("%x", sha1.Sum(data))
+	if action == ActionHide {
+		sum = "none"
+	}
+	v := &fakeVersion{
+		bucketID: bucketID,
+		meta: FileMeta{
+			ID:              fmt.Sprintf("fake%d", f.nextID),
+			Name:            name,
+			Size:            int64(len(data)),
+			ContentLength:   int64(len(data)),
+			ContentSha1:     sum,
+			ContentType:     "application/octet-stream",
+			Action:          action,
+			FileInfo:        info,
+			UploadTimestamp: f.clock,
+		},
+		data: data,
+	}
+	f.versions = append(f.versions, v)
+	return v.meta
+}
+
+// current returns the newest version of every file that isn't hidden,
+// sorted by name.
+func (f *fakeB2) current(bucketID string) []*fakeVersion {
+	latest := map[string]*fakeVersion{}
+	for _, v := range f.versions {
+		if v.bucketID != bucketID {
+			continue
+		}
+		if l, ok := latest[v.meta.Name]; !ok || v.meta.UploadTimestamp > l.meta.UploadTimestamp {
+			latest[v.meta.Name] = v
+		}
+	}
+	out := []*fakeVersion{}
+	for _, v := range latest {
+		if v.meta.Action == ActionUpload {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].meta.Name < out[j].meta.Name })
+	return out
+}
+
+// all returns every version in a bucket, by name and then newest first.
+func (f *fakeB2) all(bucketID string) []*fakeVersion {
+	out := []*fakeVersion{}
+	for _, v := range f.versions {
+		if v.bucketID == bucketID {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].meta.Name != out[j].meta.Name {
+			return out[i].meta.Name < out[j].meta.Name
+		}
+		return out[i].meta.UploadTimestamp > out[j].meta.UploadTimestamp
+	})
+	return out
+}
+
+func (f *fakeB2) byID(id string) *fakeVersion {
+	for _, v := range f.versions {
+		if v.meta.ID == id {
+			return v
+		}
+	}
+	return nil
+}
+
+// names returns the names of the current files in a bucket.
+func (f *fakeB2) names(bucketID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := []string{}
+	for _, v := range f.current(bucketID) {
+		out = append(out, v.meta.Name)
+	}
+	return out
+}
+
+// data returns the data of the current version of a named file.
+func (f *fakeB2) data(bucketID, name string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, v := range f.current(bucketID) {
+		if v.meta.Name == name {
+			return v.data, true
+		}
+	}
+	return nil, false
+}
+
+func (f *fakeB2) Do(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/upload_part/"):
+		return f.uploadPart(strings.TrimPrefix(path, "/upload_part/"), r), nil
+	case strings.HasPrefix(path, "/upload/"):
+		return f.upload(strings.TrimPrefix(path, "/upload/"), r)
+	case strings.HasPrefix(path, "/file/"):
+		name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/file/"))
+		if i := strings.Index(name, "/"); i >= 0 && name[:i] == "bucket" {
+			name = name[i+1:]
+		}
+		for _, v := range f.current("id") {
+			if v.meta.Name == name {
+				return f.download(v, r), nil
+			}
+		}
+		return fakeError(404, "not_found"), nil
+	case strings.HasSuffix(path, "/b2_download_file_by_id"):
+		v := f.byID(r.URL.Query().Get("fileId"))
+		if v == nil || v.meta.Action != ActionUpload {
+			return fakeError(404, "not_found"), nil
+		}
+		return f.download(v, r), nil
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	req := map[string]interface{}{}
+	json.Unmarshal(body, &req)
+	str := func(k string) string { s, _ := req[k].(string); return s }
+
+	switch path[strings.LastIndex(path, "/")+1:] {
+	case "b2_get_upload_url":
+		return fakeJSON(map[string]string{
+			"bucketId":           str("bucketId"),
+			"uploadUrl":          "https://fake/upload/" + str("bucketId"),
+			"authorizationToken": "upload-token",
+		}), nil
+	case "b2_list_file_names":
+		return f.listNames(str("bucketId"), str("prefix"), str("delimiter"), str("startFileName"), req["maxFileCount"]), nil
+	case "b2_list_file_versions":
+		return f.listVersions(str("bucketId"), str("startFileName"), str("startFileId"), req["maxFileCount"]), nil
+	case "b2_get_file_info":
+		v := f.byID(str("fileId"))
+		if v == nil {
+			return fakeError(404, "not_found"), nil
+		}
+		return fakeJSON(v.meta), nil
+	case "b2_hide_file":
+		return fakeJSON(f.add(str("bucketId"), str("fileName"), ActionHide, nil, nil)), nil
+	case "b2_delete_file_version":
+		for i, v := range f.versions {
+			if v.meta.ID == str("fileId") && v.meta.Name == str("fileName") {
+				f.versions = append(f.versions[:i], f.versions[i+1:]...)
+				return fakeJSON(map[string]string{"fileId": v.meta.ID, "fileName": v.meta.Name}), nil
+			}
+		}
+		return fakeError(400, "file_not_present"), nil
+	case "b2_start_large_file":
+		f.nextID++
+		id := fmt.Sprintf("large%d", f.nextID)
+		info := map[string]string{}
+		if m, ok := req["fileInfo"].(map[string]interface{}); ok {
+			for k, v := range m {
+				info[k], _ = v.(string)
+			}
+		}
+		f.large[id] = &fakeLargeFile{bucketID: str("bucketId"), name: str("fileName"), info: info, parts: map[int][]byte{}}
+		return fakeJSON(FileMeta{ID: id, Name: str("fileName"), Action: ActionStart, FileInfo: info}), nil
+	case "b2_get_upload_part_url":
+		if f.large[str("fileId")] == nil {
+			return fakeError(400, "bad_request"), nil
+		}
+		return fakeJSON(UploadPartURL{
+			FileID:             str("fileId"),
+			URL:                "https://fake/upload_part/" + str("fileId"),
+			AuthorizationToken: "part-token",
+		}), nil
+	case "b2_finish_large_file":
+		lf := f.large[str("fileId")]
+		sums, _ := req["partSha1Array"].([]interface{})
+		if lf == nil || len(sums) != len(lf.parts) {
+			return fakeError(400, "bad_request"), nil
+		}
+		data := []byte{}
+		for i, sum := range sums {
+			part := lf.parts[i+1]
+			if fmt.Sprintf("%x", sha1.Sum(part)) != sum {
+				return fakeError(400, "bad_request"), nil
+			}
+			data = append(data, part...)
+		}
+		delete(f.large, str("fileId"))
+		meta := f.add(lf.bucketID, lf.name, ActionUpload, data, lf.info)
+		f.versions[len(f.versions)-1].meta.ContentSha1 = "none"
+		meta.ContentSha1 = "none"
+		return fakeJSON(meta), nil
+	case "b2_cancel_large_file":
+		lf := f.large[str("fileId")]
+		if lf == nil {
+			return fakeError(400, "bad_request"), nil
+		}
+		delete(f.large, str("fileId"))
+		return fakeJSON(map[string]string{"fileId": str("fileId"), "fileName": lf.name}), nil
+	case "b2_copy_file":
+		src := f.byID(str("sourceFileId"))
+		if src == nil {
+			return fakeError(400, "bad_request"), nil
+		}
+		dest := src.bucketID
+		if d := str("destinationBucketId"); d != "" {
+			dest = d
+		}
+		info := map[string]string{}
+		for k, v := range src.meta.FileInfo {
+			info[k] = v
+		}
+		return fakeJSON(f.add(dest, str("fileName"), ActionUpload, src.data, info)), nil
+	}
+	return fakeError(400, "unknown_path"), nil
+}
+
+func (f *fakeB2) upload(bucketID string, r *http.Request) (*http.Response, error) {
+	// uploads must use the upload URL's token, not the account's
+	if r.Header.Get("Authorization") != "upload-token" {
+		return fakeError(401, "bad_auth_token"), nil
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	if fmt.Sprintf("%x", sha1.Sum(data)) != r.Header.Get("X-Bz-Content-Sha1") {
+		return fakeError(400, "bad_request"), nil
+	}
+	name, _ := PercentDecode(r.Header.Get("X-Bz-File-Name"))
+	info := GetBzInfoHeaders(&http.Response{Header: r.Header})
+	meta := f.add(bucketID, name, ActionUpload, data, info)
+	if ct := r.Header.Get("Content-Type"); ct != "" && ct != "b2/x-auto" {
+		f.versions[len(f.versions)-1].meta.ContentType = ct
+		meta.ContentType = ct
+	}
+	return fakeJSON(meta), nil
+}
+
+func (f *fakeB2) uploadPart(fileID string, r *http.Request) *http.Response {
+	data, _ := ioutil.ReadAll(r.Body)
+	if r.Header.Get("Authorization") != "part-token" {
+		return fakeError(401, "bad_auth_token")
+	}
+	lf := f.large[fileID]
+	sum := fmt.Sprintf("%x", sha1.Sum(data))
+	if lf == nil || sum != r.Header.Get("X-Bz-Content-Sha1") {
+		return fakeError(400, "bad_request")
+	}
+	n, _ := strconv.Atoi(r.Header.Get("X-Bz-Part-Number"))
+	lf.parts[n] = data
+	return fakeJSON(Part{FileID: fileID, PartNumber: n, ContentLength: int64(len(data)), ContentSha1: sum})
+}
+
+func (f *fakeB2) download(v *fakeVersion, r *http.Request) *http.Response {
+	data := v.data
+	resp := testResponse(200, "")
+	resp.Header = http.Header{}
+	resp.Header.Set("X-Bz-File-Id", v.meta.ID)
+	resp.Header.Set("X-Bz-File-Name", PercentEncode(v.meta.Name))
+	resp.Header.Set("X-Bz-Content-Sha1", v.meta.ContentSha1)
+	resp.Header.Set("X-Bz-Upload-Timestamp", strconv.FormatInt(v.meta.UploadTimestamp, 10))
+	resp.Header.Set("Content-Type", v.meta.ContentType)
+	for k, val := range v.meta.FileInfo {
+		resp.Header.Set("X-Bz-Info-"+k, PercentEncode(val))
+	}
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start, end int
+		if n, _ := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); n < 2 {
+			end = len(data) - 1
+		}
+		if start >= len(data) {
+			return fakeError(416, "range_not_satisfiable")
+		}
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+		resp.StatusCode = 206
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		data = data[start : end+1]
+	}
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == "HEAD" {
+		data = nil
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return resp
+}
+
+func (f *fakeB2) listNames(bucketID, prefix, delimiter, start string, max interface{}) *http.Response {
+	count := fakeMax(max)
+	files := []FileMeta{}
+	seen := map[string]bool{}
+	next := ""
+	for _, v := range f.current(bucketID) {
+		name := v.meta.Name
+		if !strings.HasPrefix(name, prefix) || name < start {
+			continue
+		}
+		entry := v.meta
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				folder := name[:len(prefix)+i+len(delimiter)]
+				if seen[folder] || folder < start {
+					continue
+				}
+				seen[folder] = true
+				entry = FileMeta{Name: folder, Action: ActionFolder}
+			}
+		}
+		if len(files) == count {
+			next = entry.Name
+			break
+		}
+		files = append(files, entry)
+	}
+	return fakeJSON(ListFileResponse{Files: files, NextFileName: next})
+}
+
+func (f *fakeB2) listVersions(bucketID, start, startID string, max interface{}) *http.Response {
+	count := fakeMax(max)
+	files := []FileMeta{}
+	resp := ListFileResponse{}
+	started := startID == ""
+	for _, v := range f.all(bucketID) {
+		if v.meta.Name < start {
+			continue
+		}
+		if !started {
+			if v.meta.ID != startID {
+				continue
+			}
+			started = true
+		}
+		if len(files) == count {
+			resp.NextFileName, resp.NextFileID = v.meta.Name, v.meta.ID
+			break
+		}
+		files = append(files, v.meta)
+	}
+	resp.Files = files
+	return fakeJSON(resp)
+}
+
+func fakeMax(max interface{}) int {
+	if n, ok := max.(float64); ok && n > 0 {
+		return int(n)
+	}
+	return 100
+}
+
+func fakeJSON(v interface{}) *http.Response {
+	b, _ := json.Marshal(v)
+	return testResponse(200, string(b))
+}
+
+func fakeError(status int, code string) *http.Response {
+	return testResponse(status, fmt.Sprintf(`{"status":%d,"code":"%s","message":"%s"}`, status, code, code))
+}
@@ -1,29 +1,33 @@
 package b2
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // FileMeta is the meta information of a File, not including the file data.
 // It contains a reference to the bucket that the file is within.
 type FileMeta struct {
-	ID              string            `json:"fileId"`
-	Name            string            `json:"fileName"`
-	Size            int64             `json:"size"`
-	ContentLength   int64             `json:"contentLength"`
-	ContentSha1     string            `json:"contentSha1"`
-	ContentType     string            `json:"contentType"`
-	Action          Action            `json:"action"`
-	FileInfo        map[string]string `json:"fileInfo"`
-	UploadTimestamp int64             `json:"uploadTimestamp"`
-	Bucket          *Bucket           `json:"-"`
+	ID              string             `json:"fileId"`
+	Name            string             `json:"fileName"`
+	Size            int64              `json:"size"`
+	ContentLength   int64              `json:"contentLength"`
+	ContentSha1     string             `json:"contentSha1"`
+	ContentType     string             `json:"contentType"`
+	Action          Action             `json:"action"`
+	FileInfo        map[string]string  `json:"fileInfo"`
+	UploadTimestamp int64              `json:"uploadTimestamp"`
+	Encryption      *Encryption        `json:"serverSideEncryption,omitempty"`
+	Retention       *FileRetentionInfo `json:"fileRetention,omitempty"`
+	LegalHold       *LegalHoldInfo     `json:"legalHold,omitempty"`
+	Bucket          *Bucket            `json:"-"`
 }
 
 // Action is the state of a file.
@@ -36,18 +40,106 @@ const (
 	ActionStart  Action = "start"
 )
 
+// ActionFolder is the state of a virtual folder, returned in place of the
+// files within it when listing with a delimiter.
+const ActionFolder Action = "folder"
+
 // File is the meta information of a file with its corresponding data.
 type File struct {
 	Meta FileMeta
 	Data []byte
 }
 
+// UploadOptions are the optional settings of a file upload.
+type UploadOptions struct {
+	// FileInfo is stored as the file's metadata. At most 10 keys are
+	// allowed, including those used by the header fields below.
+	FileInfo map[string]string
+
+	// ContentType is the file's MIME type. If empty, B2 picks one based on
+	// the file name.
+	ContentType string
+
+	// These are sent as the file's headers when it's downloaded. They are
+	// stored in the b2-content-disposition, b2-content-language,
+	// b2-expires, b2-cache-control and b2-content-encoding file info keys.
+	ContentDisposition string
+	ContentLanguage    string
+	Expires            string
+	CacheControl       string
+	ContentEncoding    string
+
+	// Encryption is the server-side encryption of the file. If nil, the
+	// bucket's default encryption is used.
+	Encryption *Encryption
+
+	// Retention is the file's retention. If nil, the bucket's default
+	// retention is used. The bucket must have file lock enabled.
+	Retention *FileRetention
+
+	// LegalHold may be set to on or off. It is unset by default.
+	LegalHold LegalHold
+
+	// Compression compresses the file before it is uploaded, recording the
+	// codec and original size and sha1 in four file info keys.
+	Compression Codec
+}
+
+// DownloadOptions are the optional settings of a file download.
+type DownloadOptions struct {
+	// Encryption must hold the customer key to download a file that was
+	// uploaded with SSE-C.
+	Encryption *Encryption
+
+	// Range downloads only part of a file. The sha1 of a partial download
+	// can't be checked.
+	Range *ByteRange
+
+	// Decompress decompresses files that were uploaded with Compression,
+	// and checks them against their original size and sha1. It can't be
+	// used with Range.
+	Decompress bool
+
+	// ResponseHeaders override the headers sent with the file. Downloads
+	// using a DownloadAuthorization must request its overrides.
+	ResponseHeaders *ResponseHeaders
+}
+
+// fileSha1 is the sha1 of a file, or the sha1 given as large_file_sha1 when
+// a large file was started, or "" if the sha1 isn't known.
+func fileSha1(meta *FileMeta) string {
+	sum := strings.TrimPrefix(meta.ContentSha1, "unverified:")
+	if sum == "none" {
+		sum = meta.FileInfo["large_file_sha1"]
+	}
+	return sum
+}
+
+// srcLastModified is the src_last_modified_millis a file was uploaded
+// with, if it was.
+func srcLastModified(meta *FileMeta) (int64, bool) {
+	v, ok := meta.FileInfo["src_last_modified_millis"]
+	if !ok {
+		return 0, false
+	}
+	millis, err := strconv.ParseInt(v, 10, 64)
+	return millis, err == nil
+}
+
+// ByteRange is an inclusive range of bytes within a file.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
 // listFileRequest is used for listing the contents of a bucket.
 type listFileRequest struct {
 	BucketID      string `json:"bucketId"`
 	StartFileName string `json:"startFileName,omitempty"`
 	StartFileID   string `json:"startFileId,omitempty"`
 	MaxFileCount  int64  `json:"maxFileCount,omitempty"`
+	Prefix        string `json:"prefix,omitempty"`
+	Delimiter     string `json:"delimiter,omitempty"`
 }
 
 // ListFileResponse is a list of files in a bucket and information regarding
@@ -88,6 +180,32 @@ func (b *Bucket) ListFileNames(startName string, maxCount int64) (*ListFileRespo
 	return b.parseListFile(resp)
 }
 
+// ListFileNamesWithPrefix returns FileMeta information for maxCount number
+// of files whose names begin with prefix, starting with the startName file.
+//
+// If a delimiter is given, files beyond the next delimiter after the prefix
+// are rolled up into a single entry with ActionFolder, whose name ends with
+// the delimiter. This treats the bucket as a tree of directories.
+func (b *Bucket) ListFileNamesWithPrefix(prefix, delimiter, startName string, maxCount int64) (*ListFileResponse, error) {
+	lfr := listFileRequest{
+		BucketID:      b.ID,
+		StartFileName: startName,
+		MaxFileCount:  maxCount,
+		Prefix:        prefix,
+		Delimiter:     delimiter,
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_list_file_names", lfr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return b.parseListFile(resp)
+}
+
 // ListFileVersions returns FileMeta on different versions of files.
 //
 // If a starting file ID is provided, a starting file name must also be given.
@@ -102,7 +220,7 @@ func (b *Bucket) ListFileVersions(startName, startID string, maxCount int64) (*L
 		StartFileID:   startID,
 		MaxFileCount:  maxCount,
 	}
-	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_list_file_names", lfr)
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_list_file_versions", lfr)
 	if err != nil {
 		return nil, err
 	}
@@ -152,20 +270,35 @@ func (b *Bucket) GetFileInfo(fileID string) (*FileMeta, error) {
 // The sha1 hash of the file is calculated and included in the upload info.
 // If the bucket does not have an UploadURL, one is requested and used.
 func (b *Bucket) UploadFile(name string, file io.Reader, fileInfo map[string]string) (*FileMeta, error) {
+	return b.UploadFileWithOptions(name, file, &UploadOptions{FileInfo: fileInfo})
+}
+
+// UploadFileWithOptions uploads a file to B2 with the given options,
+// returning its associated FileMeta info.
+func (b *Bucket) UploadFileWithOptions(name string, file io.Reader, opts *UploadOptions) (*FileMeta, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
 	if name == "" {
 		return nil, fmt.Errorf("No file name provided")
 	}
 	if file == nil {
 		return nil, fmt.Errorf("No file data provided")
 	}
-	if len(fileInfo) > 10 {
-		return nil, fmt.Errorf("More than 10 file info keys provided")
+	if opts.Compression != nil {
+		var err error
+		file, opts, err = compressUpload(file, opts)
+		if err != nil {
+			return nil, err
+		}
 	}
-	req, err := b.setupUploadFile(name, file, fileInfo)
+	if err := opts.validate(name); err != nil {
+		return nil, err
+	}
+	req, err := b.setupUploadFile(name, file, opts)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", b.B2.AuthorizationToken)
 	resp, err := b.B2.client.Do(req)
 	if err != nil {
 		return nil, err
@@ -173,12 +306,62 @@ func (b *Bucket) UploadFile(name string, file io.Reader, fileInfo map[string]str
 	return b.parseFileMeta(resp)
 }
 
+// validate checks the name, file info, encryption, retention and legal hold
+// of an upload.
+func (opts *UploadOptions) validate(name string) error {
+	if err := validateUploadHeaders(name, opts.fileInfo()); err != nil {
+		return err
+	}
+	if err := opts.Encryption.validate(); err != nil {
+		return err
+	}
+	if opts.Retention != nil {
+		if err := opts.Retention.validate(); err != nil {
+			return err
+		}
+	}
+	if opts.LegalHold != "" && opts.LegalHold != LegalHoldOn && opts.LegalHold != LegalHoldOff {
+		return fmt.Errorf("Legal hold must be on or off, not %q", opts.LegalHold)
+	}
+	return nil
+}
+
+// fileInfo is the file info of an upload, including the b2-* keys of its
+// header fields, which replace any of the same keys in FileInfo.
+func (opts *UploadOptions) fileInfo() map[string]string {
+	info := map[string]string{}
+	for k, v := range opts.FileInfo {
+		info[k] = v
+	}
+	headers := []struct{ key, value string }{
+		{"b2-content-disposition", opts.ContentDisposition},
+		{"b2-content-language", opts.ContentLanguage},
+		{"b2-expires", opts.Expires},
+		{"b2-cache-control", opts.CacheControl},
+		{"b2-content-encoding", opts.ContentEncoding},
+	}
+	for _, h := range headers {
+		if h.value != "" {
+			info[h.key] = h.value
+		}
+	}
+	return info
+}
+
+// contentType is the Content-Type of an upload.
+func (opts *UploadOptions) contentType() string {
+	if opts.ContentType == "" {
+		return "b2/x-auto"
+	}
+	return opts.ContentType
+}
+
 // setupUploadFile sets the required request headers, calculates the sha1 hash,
 // and retrieves a new UploadURL if necessary.
 //
 // It removes all expired UploadURLs before determining if a new one is needed.
 // It returns the constructed *http.Request.
-func (b *Bucket) setupUploadFile(name string, file io.Reader, fileInfo map[string]string) (*http.Request, error) {
+func (b *Bucket) setupUploadFile(name string, file io.Reader, opts *UploadOptions) (*http.Request, error) {
 	b.cleanUploadURLs()
 
 	uurl := &UploadURL{}
@@ -193,26 +376,26 @@ func (b *Bucket) setupUploadFile(name string, file io.Reader, fileInfo map[strin
 		}
 	}
 
-	req, err := CreateRequest("POST", uurl.URL, file)
+	bts, err := ioutil.ReadAll(file)
 	if err != nil {
 		return nil, err
 	}
 
-	bts, err := ioutil.ReadAll(file)
+	req, err := http.NewRequest("POST", uurl.URL, bytes.NewReader(bts))
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header.Set("Authorization", uurl.AuthorizationToken)
-	req.Header.Set("X-Bz-File-Name", url.QueryEscape(name))
-	req.Header.Set("Content-Type", "b2/x-auto") // TODO include type if known
+	req.Header.Set("X-Bz-File-Name", PercentEncode(name))
+	req.Header.Set("Content-Type", opts.contentType())
 	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(bts)))
 	req.Header.Set("X-Bz-Content-Sha1", fmt.Sprintf("%x", sha1.Sum(bts)))
-	for k, v := range fileInfo {
-		req.Header.Set("X-Bz-Info-"+url.QueryEscape(k), v)
+	for k, v := range opts.fileInfo() {
+		req.Header.Set("X-Bz-Info-"+PercentEncode(k), PercentEncode(v))
 	}
-	// TODO include X-Bz-Info-src_last_modified_millis
-	// TODO check for total headers being greater than 7,000 bytes
+	opts.Encryption.setUploadHeaders(req.Header)
+	setLockHeaders(req.Header, opts.Retention, opts.LegalHold)
 
 	return req, nil
 }
@@ -221,8 +404,8 @@ func (b *Bucket) setupUploadFile(name string, file io.Reader, fileInfo map[strin
 //
 // A new UploadURL will be obtained even if a valid one already exists.
 func (b *Bucket) GetUploadURL() (*UploadURL, error) {
-	body := fmt.Sprintf(`{"bucketId":"%s"}`, b.ID)
-	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_get_upload_url", body)
+	fmr := fileMetaRequest{BucketID: b.ID}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_get_upload_url", fmr)
 	if err != nil {
 		return nil, err
 	}
@@ -250,53 +433,103 @@ func (b *Bucket) parseGetUploadURL(resp *http.Response) (*UploadURL, error) {
 //
 // If the Bucket is private, Authorization will be set automatically.
 func (b *Bucket) DownloadFileByName(name string) (*File, error) {
-	req, err := CreateRequest("GET", b.B2.DownloadURL+"/file/"+name, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	if b.Type == AllPrivate {
-		req.Header.Set("Authorization", b.B2.AuthorizationToken)
-	}
-
-	// ignoring the "Range" header
-	// that will be in the file part section (when added)
+	return b.DownloadFileByNameWithOptions(name, nil)
+}
 
-	resp, err := b.B2.client.Do(req)
+// DownloadFileByNameWithOptions gets a File from B2 given the file's name
+// and download options.
+//
+// If the Bucket is private, Authorization will be set automatically.
+func (b *Bucket) DownloadFileByNameWithOptions(name string, opts *DownloadOptions) (*File, error) {
+	req, err := CreateRequest("GET", b.fileURL(name), nil)
 	if err != nil {
 		return nil, err
 	}
-	return b.parseFile(resp)
+	return b.downloadFile(req, opts)
 }
 
 // DownloadFileByID gets a File from B2 given the file's ID.
 //
 // If the Bucket is private, Authorization will be set automatically.
 func (b *Bucket) DownloadFileByID(id string) (*File, error) {
+	return b.DownloadFileByIDWithOptions(id, nil)
+}
+
+// DownloadFileByIDWithOptions gets a File from B2 given the file's ID and
+// download options.
+//
+// If the Bucket is private, Authorization will be set automatically.
+func (b *Bucket) DownloadFileByIDWithOptions(id string, opts *DownloadOptions) (*File, error) {
 	req, err := CreateRequest("GET", b.B2.DownloadURL+"/b2api/v1/b2_download_file_by_id?fileId="+id, nil)
 	if err != nil {
 		return nil, err
 	}
+	return b.downloadFile(req, opts)
+}
 
-	if b.Type == AllPrivate {
-		req.Header.Set("Authorization", b.B2.AuthorizationToken)
+// downloadFile sets the authorization and option headers on a download
+// request, then makes it.
+func (b *Bucket) downloadFile(req *http.Request, opts *DownloadOptions) (*File, error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	if err := opts.Encryption.validate(); err != nil {
+		return nil, err
+	}
+	if r := opts.Range; r != nil && (r.Start < 0 || r.End < r.Start) {
+		return nil, fmt.Errorf("Invalid range %d-%d", r.Start, r.End)
+	}
+	if opts.Range != nil && opts.Decompress {
+		return nil, fmt.Errorf("Can't decompress a ranged download")
 	}
 
-	// ignoring the "Range" header
-	// that will be in the file part section (when added)
+	b.authorizeDownload(req, opts.Encryption)
+	if opts.ResponseHeaders != nil {
+		q := req.URL.Query()
+		for k, v := range opts.ResponseHeaders.query() {
+			q[k] = v
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+	if r := opts.Range; r != nil {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.Start, r.End))
+	}
+	// setting Accept-Encoding stops net/http from decompressing gzip
+	// itself, which would drop the Content-Length and break the sha1 check
+	if opts.Decompress {
+		req.Header.Set("Accept-Encoding", acceptEncoding())
+	} else {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
 
 	resp, err := b.B2.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	return b.parseFile(resp)
+	f, err := b.parseFile(resp)
+	if err != nil || !opts.Decompress {
+		return f, err
+	}
+	return decompressFile(f)
+}
+
+// authorizeDownload sets the authorization of a private bucket and the
+// customer key headers of an SSE-C file on a download request.
+func (b *Bucket) authorizeDownload(req *http.Request, enc *Encryption) {
+	if b.Type == AllPrivate {
+		req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	}
+	enc.setDownloadHeaders(req.Header)
 }
 
 // parseFile turns a download file response into a *File.
+//
+// A partial (ranged) response has its Size set to the size of the whole
+// file, and its sha1 is not checked.
 func (b *Bucket) parseFile(resp *http.Response) (*File, error) {
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
+	if resp.StatusCode != 200 && resp.StatusCode != 206 {
 		return nil, parseAPIError(resp)
 	}
 
@@ -310,26 +543,71 @@ func (b *Bucket) parseFile(resp *http.Response) (*File, error) {
 		return nil, err
 	}
 
-	if fmt.Sprintf("%x", sha1.Sum(bts)) != resp.Header.Get("X-Bz-Content-Sha1") {
+	size := int64(len(bts))
+	if resp.StatusCode == 206 {
+		size, err = contentRangeSize(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+	} else if !sha1Matches(bts, resp.Header) {
 		// TODO? retry download
 		return nil, fmt.Errorf("File sha1 didn't match provided sha1")
 	}
 
+	meta := metaFromHeaders(resp.Header)
+	meta.Size = size
+	meta.ContentLength = int64(clen)
+	meta.Bucket = b
 	return &File{
-		Meta: FileMeta{
-			ID:            resp.Header.Get("X-Bz-File-Id"),
-			Name:          resp.Header.Get("X-Bz-File-Name"),
-			Size:          int64(len(bts)),
-			ContentLength: int64(clen),
-			ContentSha1:   resp.Header.Get("X-Bz-Content-Sha1"),
-			ContentType:   resp.Header.Get("Content-Type"),
-			FileInfo:      GetBzInfoHeaders(resp),
-			Bucket:        b,
-		},
+		Meta: meta,
 		Data: bts,
 	}, nil
 }
 
+// metaFromHeaders returns the FileMeta described by the headers of a
+// download response. Its Size, ContentLength and Bucket are left for the
+// caller to set.
+func metaFromHeaders(h http.Header) FileMeta {
+	retention, hold := lockFromHeaders(h)
+	uploaded, _ := strconv.ParseInt(h.Get("X-Bz-Upload-Timestamp"), 10, 64)
+	return FileMeta{
+		ID:              h.Get("X-Bz-File-Id"),
+		Name:            decodeHeader(h.Get("X-Bz-File-Name")),
+		ContentSha1:     h.Get("X-Bz-Content-Sha1"),
+		ContentType:     h.Get("Content-Type"),
+		Action:          ActionUpload,
+		FileInfo:        GetBzInfoHeaders(&http.Response{Header: h}),
+		UploadTimestamp: uploaded,
+		Encryption:      encryptionFromHeaders(h),
+		Retention:       retention,
+		LegalHold:       hold,
+	}
+}
+
+// sha1Matches checks downloaded data against its X-Bz-Content-Sha1. The sha1
+// of a large file is "none", so it can only be checked if the sha1 was given
+// as large_file_sha1 when the file was started.
+func sha1Matches(data []byte, h http.Header) bool {
+	sum := h.Get("X-Bz-Content-Sha1")
+	if sum == "none" {
+		sum = h.Get("X-Bz-Info-large_file_sha1")
+		if sum == "" {
+			return true
+		}
+	}
+	return fmt.Sprintf("%x", sha1.Sum(data)) == sum
+}
+
+// contentRangeSize returns the total size from a Content-Range header,
+// such as "bytes 0-99/1234".
+func contentRangeSize(contentRange string) (int64, error) {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("Invalid Content-Range %q", contentRange)
+	}
+	return strconv.ParseInt(contentRange[i+1:], 10, 64)
+}
+
 // HideFile prevents a named file from being returned during a ListFileNames
 // or DownloadFileByName request.
 //
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"testing"
 	"time"
 )
@@ -139,12 +140,15 @@ func TestBucket_UploadFile(t *testing.T) {
 		}
 	}
 
-	bucket.UploadURLs = []*UploadURL{testUploadURL()}
+	// uploads use the upload URL's token, not the account's
+	uurl := testUploadURL()
+	uurl.AuthorizationToken = "upload-token"
+	bucket.UploadURLs = []*UploadURL{uurl}
 	bucket.UploadFile("name", file, nil)
 	req := bucket.B2.client.(*testClient).Request
 	auth, ok := req.Header["Authorization"]
-	if !ok || auth[0] != bucket.B2.AuthorizationToken {
-		t.Errorf("Expected auth to be %s, instead got %s", bucket.B2.AuthorizationToken, auth)
+	if !ok || auth[0] != uurl.AuthorizationToken {
+		t.Errorf("Expected auth to be %s, instead got %s", uurl.AuthorizationToken, auth)
 	}
 }
 
@@ -174,7 +178,7 @@ func TestBucket_setupUploadFile(t *testing.T) {
 	}
 	bucket := testBucket()
 	bucket.UploadURLs = uploadURLs
-	req, err := bucket.setupUploadFile(fileName, fileData, fileInfo)
+	req, err := bucket.setupUploadFile(fileName, fileData, &UploadOptions{FileInfo: fileInfo})
 	if err != nil {
 		t.Fatalf("Expected no error, instead got %s", err)
 	}
@@ -189,6 +193,78 @@ func TestBucket_setupUploadFile(t *testing.T) {
 	}
 }
 
+func TestBucket_setupUploadFile_headers(t *testing.T) {
+	bucket := testBucket()
+	bucket.UploadURLs = []*UploadURL{testUploadURL()}
+	opts := &UploadOptions{
+		FileInfo:           map[string]string{"b2-cache-control": "no-cache", "owner": "ops"},
+		ContentType:        "text/plain",
+		ContentDisposition: "attachment; filename=cats.txt",
+		ContentLanguage:    "en",
+		Expires:            "Thu, 01 Dec 1994 16:00:00 GMT",
+		CacheControl:       "max-age=3600",
+	}
+	req, err := bucket.setupUploadFile("cats.txt", bytes.NewReader([]byte("cats")), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	checks := map[string]string{
+		"Content-Type":                     "text/plain",
+		"X-Bz-Info-b2-content-disposition": "attachment%3B%20filename%3Dcats.txt",
+		"X-Bz-Info-b2-content-language":    "en",
+		"X-Bz-Info-b2-expires":             "Thu%2C%2001%20Dec%201994%2016%3A00%3A00%20GMT",
+		"X-Bz-Info-b2-cache-control":       "max-age%3D3600",
+		"X-Bz-Info-owner":                  "ops",
+	}
+	for k, v := range checks {
+		if req.Header.Get(k) != v {
+			t.Errorf("Expected req header %s to be %s, instead got %s", k, v, req.Header.Get(k))
+		}
+	}
+	if _, ok := req.Header["X-Bz-Info-B2-Content-Encoding"]; ok {
+		t.Error("Expected no content encoding header")
+	}
+}
+
+func TestUploadOptions_validate(t *testing.T) {
+	info := map[string]string{"1": "", "2": "", "3": "", "4": "", "5": "", "6": "", "7": "", "8": "", "9": ""}
+	cases := []struct {
+		opts     *UploadOptions
+		expected string // the error, or "" for success
+	}{
+		{opts: &UploadOptions{FileInfo: info, CacheControl: "no-cache"}},
+		{opts: &UploadOptions{FileInfo: info, CacheControl: "no-cache", ContentLanguage: "en"}, expected: "More than 10 file info keys provided"},
+		{opts: &UploadOptions{Expires: "Thu, 01 Dec 1994 16:00:00 GMT"}},
+		{opts: &UploadOptions{Expires: "tomorrow"}, expected: `Invalid file info key "b2-expires": value "tomorrow" is not an HTTP date`},
+		{opts: &UploadOptions{ContentEncoding: "gzip", Compression: Gzip}, expected: "ContentEncoding can't be set with Compression"},
+	}
+	for i, c := range cases {
+		bucket, _ := testFakeBucket()
+		_, err := bucket.UploadFileWithOptions("name", bytes.NewReader([]byte("cats")), c.opts)
+		if c.expected == "" && err != nil {
+			t.Errorf("Expected no error, instead got %s, case %d", err, i)
+		}
+		if c.expected != "" && (err == nil || err.Error() != c.expected) {
+			t.Errorf("Expected %s, instead got %v, case %d", c.expected, err, i)
+		}
+	}
+}
+
+func TestBucket_DownloadFileByIDWithOptions_responseHeaders(t *testing.T) {
+	bucket := testBucket()
+	bucket.DownloadFileByIDWithOptions("id", &DownloadOptions{
+		ResponseHeaders: &ResponseHeaders{ContentDisposition: "inline", ContentType: "text/plain"},
+	})
+	req := bucket.B2.client.(*testClient).Request
+	q := req.URL.Query()
+	if q.Get("fileId") != "id" {
+		t.Errorf("Expected fileId to be id, instead got %s", q.Get("fileId"))
+	}
+	if q.Get("b2ContentDisposition") != "inline" || q.Get("b2ContentType") != "text/plain" {
+		t.Errorf("Expected the response header overrides, instead got %v", q)
+	}
+}
+
 func TestBucket_GetUploadURL(t *testing.T) {
 	bucket := testBucket()
 	bucket.GetUploadURL()
@@ -197,6 +273,10 @@ func TestBucket_GetUploadURL(t *testing.T) {
 	if !ok || auth[0] != bucket.B2.AuthorizationToken {
 		t.Errorf("Expected auth to be %s, instead got %s", bucket.B2.AuthorizationToken, auth)
 	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"bucketId":"id"}` {
+		t.Errorf(`Expected body to be {"bucketId":"id"}, instead got %s`, body)
+	}
 }
 
 func TestBucket_parseGetUploadURL(t *testing.T) {
@@ -333,6 +413,68 @@ func TestBucket_parseFile(t *testing.T) {
 	}
 }
 
+func TestBucket_DownloadFileByNameWithOptions_range(t *testing.T) {
+	bucket := testBucket()
+	bucket.DownloadFileByNameWithOptions("name", &DownloadOptions{Range: &ByteRange{Start: 5, End: 9}})
+	req := bucket.B2.client.(*testClient).Request
+	if req.Header.Get("Range") != "bytes=5-9" {
+		t.Errorf(`Expected range to be "bytes=5-9", instead got %s`, req.Header.Get("Range"))
+	}
+
+	file, err := bucket.DownloadFileByNameWithOptions("name", &DownloadOptions{Range: &ByteRange{Start: 9, End: 5}})
+	if err == nil {
+		t.Error("Expected a backwards range to fail")
+	}
+	if file != nil {
+		t.Errorf("Expected file to be nil, instead got %+v", file)
+	}
+}
+
+func TestBucket_parseFile_partial(t *testing.T) {
+	resp := testResponse(206, "cats")
+	resp.Header = map[string][]string{
+		"X-Bz-File-Id":      {"1"},
+		"Content-Length":    {"4"},
+		"Content-Range":     {"bytes 5-8/19"},
+		"X-Bz-Content-Sha1": {"78498e5096b20e3f1c063e8740ff83d595ededb3"},
+	}
+	file, err := testBucket().parseFile(resp)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if file.Meta.Size != 19 {
+		t.Errorf("Expected size to be the whole file, 19, instead got %d", file.Meta.Size)
+	}
+	if file.Meta.ContentLength != 4 || string(file.Data) != "cats" {
+		t.Errorf(`Expected 4 bytes of "cats", instead got %d of %q`, file.Meta.ContentLength, file.Data)
+	}
+}
+
+func TestBucket_parseFile_largeFile(t *testing.T) {
+	cases := []struct {
+		info    string
+		success bool
+	}{
+		{info: "", success: true},
+		{info: "cc90fda9b1a7483de0af0a2364167decfdb1d247", success: true},
+		{info: "78498e5096b20e3f1c063e8740ff83d595ededb3", success: false},
+	}
+	for i, c := range cases {
+		resp := testResponse(200, "dogs")
+		resp.Header = map[string][]string{
+			"Content-Length":    {"4"},
+			"X-Bz-Content-Sha1": {"none"},
+		}
+		if c.info != "" {
+			resp.Header.Set("X-Bz-Info-large_file_sha1", c.info)
+		}
+		_, err := testBucket().parseFile(resp)
+		if (err == nil) != c.success {
+			t.Errorf("Expected success to be %t, instead got %v, case %d", c.success, err, i)
+		}
+	}
+}
+
 func TestBucket_HideFile(t *testing.T) {
 	bucket := testBucket()
 	bucket.HideFile("name")
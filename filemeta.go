@@ -0,0 +1,93 @@
+package b2
+
+import (
+	"fmt"
+	"time"
+)
+
+// UploadTime returns the time the file was uploaded, or the zero time if
+// the UploadTimestamp isn't known.
+func (m *FileMeta) UploadTime() time.Time {
+	if m.UploadTimestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, m.UploadTimestamp*int64(time.Millisecond))
+}
+
+// Download downloads this version of the file.
+func (m *FileMeta) Download(opts *DownloadOptions) (*File, error) {
+	b, err := m.bucket()
+	if err != nil {
+		return nil, err
+	}
+	return b.DownloadFileByIDWithOptions(m.ID, opts)
+}
+
+// Open returns a Reader over this version of the file, for streaming or
+// random access.
+func (m *FileMeta) Open(opts *ReaderOptions) (*Reader, error) {
+	b, err := m.bucket()
+	if err != nil {
+		return nil, err
+	}
+	return b.OpenByID(m.ID, opts)
+}
+
+// Hide hides the file by name, returning the FileMeta of the hide marker.
+//
+// Like HideFile, this hides whatever version of the file is current, which
+// may be newer than this one.
+func (m *FileMeta) Hide() (*FileMeta, error) {
+	b, err := m.bucket()
+	if err != nil {
+		return nil, err
+	}
+	return b.HideFile(m.Name)
+}
+
+// Delete deletes this version of the file.
+func (m *FileMeta) Delete() (*FileMeta, error) {
+	b, err := m.bucket()
+	if err != nil {
+		return nil, err
+	}
+	return b.DeleteFileVersion(m.Name, m.ID)
+}
+
+// Copy makes a server-side copy of this version of the file, like
+// CopyFile. If dest is nil the copy is placed in the file's Bucket.
+func (m *FileMeta) Copy(newName string, dest *Bucket) (*FileMeta, error) {
+	b, err := m.bucket()
+	if err != nil {
+		return nil, err
+	}
+	return b.CopyFile(m.ID, newName, dest)
+}
+
+// Refresh gets the file's info from B2 again, replacing the FileMeta's
+// fields with it.
+func (m *FileMeta) Refresh() error {
+	b, err := m.bucket()
+	if err != nil {
+		return err
+	}
+	fresh, err := b.GetFileInfo(m.ID)
+	if err != nil {
+		return err
+	}
+	*m = *fresh
+	m.Bucket = b
+	return nil
+}
+
+// bucket returns the Bucket the file is in. Every FileMeta returned by a
+// Bucket has one, but a FileMeta made by hand may not.
+func (m *FileMeta) bucket() (*Bucket, error) {
+	if m.Bucket == nil {
+		return nil, fmt.Errorf("FileMeta has no Bucket")
+	}
+	if m.ID == "" {
+		return nil, fmt.Errorf("No fileID provided")
+	}
+	return m.Bucket, nil
+}
@@ -0,0 +1,86 @@
+package b2
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestFileMeta_UploadTime(t *testing.T) {
+	meta := FileMeta{UploadTimestamp: 1500000000123}
+	expected := time.Date(2017, 7, 14, 2, 40, 0, 123000000, time.UTC)
+	if !meta.UploadTime().Equal(expected) {
+		t.Errorf("Expected %s, instead got %s", expected, meta.UploadTime())
+	}
+	if !(&FileMeta{}).UploadTime().IsZero() {
+		t.Error("Expected an unknown upload time to be zero")
+	}
+}
+
+func TestFileMeta_methods(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "cats.txt", []byte("cats"), map[string]string{"owner": "ifo"})
+
+	list, err := bucket.ListFileNames("", 0)
+	if err != nil || len(list.Files) != 1 {
+		t.Fatalf("Expected one file, instead got %+v with %v", list, err)
+	}
+	meta := &list.Files[0]
+
+	f, err := meta.Download(nil)
+	if err != nil || string(f.Data) != "cats" {
+		t.Errorf("Expected to download cats, instead got %+v with %v", f, err)
+	}
+
+	r, err := meta.Open(nil)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "cats" {
+		t.Errorf("Expected to read cats, instead got %q with %v", data, err)
+	}
+
+	cp, err := meta.Copy("copy.txt", nil)
+	if err != nil || cp.Name != "copy.txt" || cp.Bucket != bucket {
+		t.Errorf("Expected a copy, instead got %+v with %v", cp, err)
+	}
+
+	meta.FileInfo = nil
+	if err := meta.Refresh(); err != nil || meta.FileInfo["owner"] != "ifo" || meta.Bucket != bucket {
+		t.Errorf("Expected the file info to be refreshed, instead got %+v with %v", meta, err)
+	}
+
+	hidden, err := meta.Hide()
+	if err != nil || hidden.Action != ActionHide || hidden.Name != "cats.txt" {
+		t.Errorf("Expected a hide marker, instead got %+v with %v", hidden, err)
+	}
+	if _, err := bucket.DownloadFileByName("cats.txt"); err == nil {
+		t.Error("Expected the hidden file not to download by name")
+	}
+
+	if _, err := meta.Delete(); err != nil {
+		t.Errorf("Expected no error, instead got %s", err)
+	}
+	if fake.byID(meta.ID) != nil {
+		t.Error("Expected the file version to be deleted")
+	}
+}
+
+func TestFileMeta_noBucket(t *testing.T) {
+	meta := &FileMeta{ID: "id", Name: "cats.txt"}
+	if _, err := meta.Download(nil); err == nil {
+		t.Error("Expected a FileMeta without a Bucket to fail")
+	}
+	if err := meta.Refresh(); err == nil {
+		t.Error("Expected a FileMeta without a Bucket to fail")
+	}
+	meta = &FileMeta{Name: "cats.txt", Bucket: testBucket()}
+	if _, err := meta.Delete(); err == nil {
+		t.Error("Expected a FileMeta without an ID to fail")
+	}
+	if req := meta.Bucket.B2.client.(*testClient).Request; req != nil {
+		t.Errorf("Expected no request to be made, instead got %s", req.URL)
+	}
+}
@@ -0,0 +1,149 @@
+package b2
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Handler is an http.Handler serving the current files of a Bucket by path,
+// so that a private bucket can be proxied to users the caller has
+// authenticated.
+//
+// Requests for "/a/b.txt" serve the file named "a/b.txt". Files are streamed
+// from B2 with ranged downloads, and Range, If-None-Match, If-Modified-Since
+// and HEAD requests are handled by http.ServeContent. The ETag of a file is
+// its sha1, and each of its file info keys is sent as an X-Bz-Info-* header.
+type Handler struct {
+	Bucket *Bucket
+
+	// ListDirectories serves an HTML listing for directory paths. Otherwise
+	// directories are not found.
+	ListDirectories bool
+
+	// Encryption must hold the customer key to serve files that were
+	// uploaded with SSE-C.
+	Encryption *Encryption
+}
+
+// Handler returns an http.Handler serving the bucket's files.
+func (b *Bucket) Handler() *Handler {
+	return &Handler{Bucket: b}
+}
+
+// ServeHTTP serves a file or directory listing.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upath := r.URL.Path
+	if !strings.HasPrefix(upath, "/") {
+		upath = "/" + upath
+	}
+	name := strings.TrimPrefix(path.Clean(upath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	bfs := h.Bucket.FS()
+	info, err := bfs.Stat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "502 bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	// redirect to the canonical path, as http.FileServer does
+	isDirPath := strings.HasSuffix(upath, "/")
+	if info.IsDir() && !isDirPath {
+		localRedirect(w, r, path.Base(upath)+"/")
+		return
+	}
+	if !info.IsDir() && isDirPath {
+		localRedirect(w, r, "../"+path.Base(upath))
+		return
+	}
+
+	if info.IsDir() {
+		if !h.ListDirectories {
+			http.NotFound(w, r)
+			return
+		}
+		h.serveDir(w, bfs, name)
+		return
+	}
+
+	meta := info.Sys().(*FileMeta)
+	header := w.Header()
+	for k, v := range meta.FileInfo {
+		if strings.HasPrefix(k, "b2-") {
+			// b2-content-disposition and the like are sent as the header
+			header.Set(textproto.CanonicalMIMEHeaderKey(k[3:]), v)
+			continue
+		}
+		header.Set("X-Bz-Info-"+k, PercentEncode(v))
+	}
+	if tag := etag(meta); tag != "" {
+		header.Set("Etag", tag)
+	}
+	if meta.ContentType != "" {
+		header.Set("Content-Type", meta.ContentType)
+	}
+
+	rs := &streamReader{bucket: h.Bucket, meta: meta, enc: h.Encryption}
+	defer rs.Close()
+	http.ServeContent(w, r, "", info.ModTime(), rs)
+}
+
+// serveDir writes an HTML listing of a directory.
+func (h *Handler) serveDir(w http.ResponseWriter, bfs *BucketFS, name string) {
+	entries, err := bfs.ReadDir(name)
+	if err != nil {
+		http.Error(w, "502 bad gateway", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<pre>\n")
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(n))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// localRedirect redirects to a path relative to the request, keeping its
+// query.
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// etag is the quoted sha1 of a file, or the sha1 given when a large file
+// was started, or "" if the sha1 isn't known.
+func etag(meta *FileMeta) string {
+	sum := fileSha1(meta)
+	if sum == "" {
+		return ""
+	}
+	return `"` + sum + `"`
+}
@@ -0,0 +1,143 @@
+package b2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_file(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	meta := fake.put("id", "dir/cats.txt", []byte("all the cats"), map[string]string{
+		"owner":                  "ops",
+		"b2-content-disposition": "attachment",
+	})
+	h := bucket.Handler()
+
+	w := testServe(h, "GET", "/dir/cats.txt", nil)
+	if w.Code != 200 || w.Body.String() != "all the cats" {
+		t.Fatalf("Expected the file, instead got %d %q", w.Code, w.Body.String())
+	}
+	expected := map[string]string{
+		"Content-Length":      "12",
+		"Content-Type":        "application/octet-stream",
+		"Etag":                `"` + meta.ContentSha1 + `"`,
+		"X-Bz-Info-Owner":     "ops",
+		"Content-Disposition": "attachment",
+		"Accept-Ranges":       "bytes",
+	}
+	for k, v := range expected {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("Expected header %s to be %q, instead got %q", k, v, got)
+		}
+	}
+	if auth := fake.requests[len(fake.requests)-1].Header.Get("Authorization"); auth != "token" {
+		t.Errorf("Expected the private download to be authorized, instead got %q", auth)
+	}
+
+	w = testServe(h, "GET", "/dir/cats.txt", map[string]string{"Range": "bytes=4-6"})
+	if w.Code != 206 || w.Body.String() != "the" {
+		t.Errorf("Expected a partial response, instead got %d %q", w.Code, w.Body.String())
+	}
+	if cr := w.Header().Get("Content-Range"); cr != "bytes 4-6/12" {
+		t.Errorf("Expected Content-Range to be bytes 4-6/12, instead got %s", cr)
+	}
+	if rng := fake.requests[len(fake.requests)-1].Header.Get("Range"); rng != "bytes=4-" {
+		t.Errorf("Expected the download to start at the range, instead got %q", rng)
+	}
+
+	requests := len(fake.requests)
+	w = testServe(h, "HEAD", "/dir/cats.txt", nil)
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "12" {
+		t.Errorf("Expected a HEAD response, instead got %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if len(fake.requests) != requests+1 {
+		t.Errorf("Expected HEAD to only list the file, instead made %d requests", len(fake.requests)-requests)
+	}
+
+	w = testServe(h, "POST", "/dir/cats.txt", nil)
+	if w.Code != 405 || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("Expected POST to not be allowed, instead got %d", w.Code)
+	}
+}
+
+func TestHandler_conditional(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	meta := fake.put("id", "cats.txt", []byte("cats"), map[string]string{"src_last_modified_millis": "1500000000000"})
+	h := bucket.Handler()
+	modified := time.Unix(1500000000, 0).UTC().Format(http.TimeFormat)
+
+	cases := []struct {
+		headers map[string]string
+		code    int
+	}{
+		{headers: map[string]string{"If-None-Match": `"` + meta.ContentSha1 + `"`}, code: 304},
+		{headers: map[string]string{"If-None-Match": `"other"`}, code: 200},
+		{headers: map[string]string{"If-Modified-Since": modified}, code: 304},
+		{headers: map[string]string{"If-Modified-Since": time.Unix(1400000000, 0).UTC().Format(http.TimeFormat)}, code: 200},
+	}
+	for i, c := range cases {
+		w := testServe(h, "GET", "/cats.txt", c.headers)
+		if w.Code != c.code {
+			t.Errorf("Expected status %d, instead got %d, case %d", c.code, w.Code, i)
+		}
+	}
+
+	w := testServe(h, "GET", "/cats.txt", nil)
+	if lm := w.Header().Get("Last-Modified"); lm != modified {
+		t.Errorf("Expected Last-Modified to be %s, instead got %s", modified, lm)
+	}
+}
+
+func TestHandler_directories(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "dir/a.txt", []byte("a"), nil)
+	fake.put("id", "dir/sub/b.txt", []byte("b"), nil)
+	fake.put("id", "file", []byte("f"), nil)
+	h := bucket.Handler()
+
+	cases := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{path: "/dir/", code: 404},
+		{path: "/dir", code: 301, location: "dir/"},
+		{path: "/file/", code: 301, location: "../file"},
+		{path: "/missing", code: 404},
+	}
+	for _, c := range cases {
+		w := testServe(h, "GET", c.path, nil)
+		if w.Code != c.code || w.Header().Get("Location") != c.location {
+			t.Errorf("Expected %d %q for %s, instead got %d %q", c.code, c.location, c.path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	h.ListDirectories = true
+	w := testServe(h, "GET", "/dir/", nil)
+	if w.Code != 200 {
+		t.Fatalf("Expected a listing, instead got %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, link := range []string{`<a href="a.txt">a.txt</a>`, `<a href="sub/">sub/</a>`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("Expected the listing to contain %s, instead got %s", link, body)
+		}
+	}
+	w = testServe(h, "GET", "/", nil)
+	if !strings.Contains(w.Body.String(), `<a href="file">file</a>`) {
+		t.Errorf("Expected the root listing to contain file, instead got %s", w.Body.String())
+	}
+}
+
+func testServe(h http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,200 @@
+package b2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Large files are uploaded in parts of between MinPartSize and 5GB, except
+// for the last part, which may be smaller. There may be at most 10,000 parts.
+const (
+	MinPartSize = 5 * 1000 * 1000
+	MaxParts    = 10000
+)
+
+// UploadPartURL is a URL used for uploading the parts of one large file.
+// Like an UploadURL, it has its own Authorization Token.
+type UploadPartURL struct {
+	FileID             string `json:"fileId"`
+	URL                string `json:"uploadUrl"`
+	AuthorizationToken string `json:"authorizationToken"`
+}
+
+// Part is an uploaded part of a large file.
+type Part struct {
+	FileID        string `json:"fileId"`
+	PartNumber    int    `json:"partNumber"`
+	ContentLength int64  `json:"contentLength"`
+	ContentSha1   string `json:"contentSha1"`
+}
+
+// startLargeFileRequest is used for starting a large file.
+type startLargeFileRequest struct {
+	BucketID    string            `json:"bucketId"`
+	FileName    string            `json:"fileName"`
+	ContentType string            `json:"contentType"`
+	FileInfo    map[string]string `json:"fileInfo,omitempty"`
+	Encryption  *Encryption       `json:"serverSideEncryption,omitempty"`
+	Retention   *FileRetention    `json:"fileRetention,omitempty"`
+	LegalHold   LegalHold         `json:"legalHold,omitempty"`
+}
+
+// finishLargeFileRequest is used for finishing a large file.
+type finishLargeFileRequest struct {
+	FileID        string   `json:"fileId"`
+	PartSha1Array []string `json:"partSha1Array"`
+}
+
+// StartLargeFile begins a large file upload, returning the FileMeta of the
+// unfinished file. Its parts are uploaded with UploadPart, and it becomes a
+// file once FinishLargeFile is called.
+//
+// The options are the same as for UploadFileWithOptions, except that
+// Compression isn't supported. An SSE-C customer key must also be given to
+// each UploadPart.
+func (b *Bucket) StartLargeFile(name string, opts *UploadOptions) (*FileMeta, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("No file name provided")
+	}
+	if opts.Compression != nil {
+		return nil, fmt.Errorf("Compression isn't supported for large files")
+	}
+	if err := opts.validate(name); err != nil {
+		return nil, err
+	}
+
+	slr := startLargeFileRequest{
+		BucketID:    b.ID,
+		FileName:    name,
+		ContentType: opts.contentType(),
+		FileInfo:    opts.fileInfo(),
+		Retention:   opts.Retention,
+		LegalHold:   opts.LegalHold,
+	}
+	if enc := opts.Encryption.withDefaults(); enc != nil {
+		// the customer key is sent with each part instead
+		slr.Encryption = &Encryption{Mode: enc.Mode, Algorithm: enc.Algorithm}
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_start_large_file", slr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return b.parseFileMeta(resp)
+}
+
+// GetUploadPartURL gets a URL for uploading the parts of a large file.
+func (b *Bucket) GetUploadPartURL(fileID string) (*UploadPartURL, error) {
+	if fileID == "" {
+		return nil, fmt.Errorf("fileID must be provided")
+	}
+	fmr := fileMetaRequest{FileID: fileID}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_get_upload_part_url", fmr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	u := &UploadPartURL{}
+	if err := parseResponse(resp, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UploadPart uploads part number partNumber, starting at 1, of a large file.
+//
+// enc must hold the customer key if the file was started with SSE-C, and is
+// otherwise ignored.
+func (b *Bucket) UploadPart(u *UploadPartURL, partNumber int, data []byte, enc *Encryption) (*Part, error) {
+	if u == nil {
+		return nil, fmt.Errorf("No upload part URL provided")
+	}
+	if partNumber < 1 || partNumber > MaxParts {
+		return nil, fmt.Errorf("Part number must be between 1 and %d, not %d", MaxParts, partNumber)
+	}
+	if err := enc.validate(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", u.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", u.AuthorizationToken)
+	req.Header.Set("X-Bz-Part-Number", strconv.Itoa(partNumber))
+	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	req.Header.Set("X-Bz-Content-Sha1", fmt.Sprintf("%x", sha1.Sum(data)))
+	if enc := enc.withDefaults(); enc != nil && enc.Mode == EncryptionSSEC {
+		enc.setCustomerKeyHeaders(req.Header)
+	}
+
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	p := &Part{}
+	if err := parseResponse(resp, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FinishLargeFile combines the uploaded parts of a large file into a file.
+// partSha1s are the sha1s of every part, in order.
+//
+// The ContentSha1 of a large file is "none".
+func (b *Bucket) FinishLargeFile(fileID string, partSha1s []string) (*FileMeta, error) {
+	if fileID == "" {
+		return nil, fmt.Errorf("fileID must be provided")
+	}
+	if len(partSha1s) == 0 {
+		return nil, fmt.Errorf("No part sha1s provided")
+	}
+
+	flr := finishLargeFileRequest{
+		FileID:        fileID,
+		PartSha1Array: partSha1s,
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_finish_large_file", flr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return b.parseFileMeta(resp)
+}
+
+// CancelLargeFile cancels an unfinished large file, deleting its parts.
+func (b *Bucket) CancelLargeFile(fileID string) error {
+	if fileID == "" {
+		return fmt.Errorf("fileID must be provided")
+	}
+	fmr := fileMetaRequest{FileID: fileID}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_cancel_large_file", fmr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return parseResponse(resp, &fileMetaRequest{})
+}
@@ -0,0 +1,110 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBucket_StartLargeFile(t *testing.T) {
+	bucket := testBucket()
+	if _, err := bucket.StartLargeFile("", nil); err == nil {
+		t.Error("Expected no file name to fail")
+	}
+	if _, err := bucket.StartLargeFile("name", &UploadOptions{Compression: Gzip}); err == nil {
+		t.Error("Expected compression to fail")
+	}
+
+	enc, _ := SSEC(testSSECKey())
+	bucket.StartLargeFile("name", &UploadOptions{Encryption: enc, FileInfo: map[string]string{"a": "b"}})
+	req := bucket.B2.client.(*testClient).Request
+	if auth := req.Header.Get("Authorization"); auth != bucket.B2.AuthorizationToken {
+		t.Errorf("Expected auth to be %s, instead got %s", bucket.B2.AuthorizationToken, auth)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	expected := `{"bucketId":"id","fileName":"name","contentType":"b2/x-auto","fileInfo":{"a":"b"},"serverSideEncryption":{"mode":"SSE-C","algorithm":"AES256"}}`
+	if string(body) != expected {
+		t.Errorf("Expected body to be %s, instead got %s", expected, body)
+	}
+}
+
+func TestBucket_UploadPart(t *testing.T) {
+	bucket := testBucket()
+	u := &UploadPartURL{FileID: "large", URL: "https://fake/part", AuthorizationToken: "part-token"}
+	for _, n := range []int{0, MaxParts + 1} {
+		if _, err := bucket.UploadPart(u, n, []byte("cats"), nil); err == nil {
+			t.Errorf("Expected part number %d to fail", n)
+		}
+	}
+
+	enc, _ := SSEC(testSSECKey())
+	bucket.UploadPart(u, 2, []byte("cats"), enc)
+	req := bucket.B2.client.(*testClient).Request
+	expected := map[string]string{
+		"Authorization":     "part-token",
+		"X-Bz-Part-Number":  "2",
+		"Content-Length":    "4",
+		"X-Bz-Content-Sha1": "8ebf601f8b808c32b8d2fb570c2e0fbdbb388add",
+		"X-Bz-Server-Side-Encryption-Customer-Key": enc.CustomerKey,
+	}
+	for k, v := range expected {
+		if got := req.Header.Get(k); got != v {
+			t.Errorf("Expected header %s to be %s, instead got %s", k, v, got)
+		}
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if !bytes.Equal(body, []byte("cats")) {
+		t.Errorf("Expected body to be cats, instead got %s", body)
+	}
+}
+
+func TestBucket_largeFile(t *testing.T) {
+	rc := testReplayClient(
+		`{"fileId":"large","fileName":"name","action":"start"}`,
+		`{"fileId":"large","uploadUrl":"https://fake/part","authorizationToken":"part-token"}`,
+		`{"fileId":"large","partNumber":1,"contentLength":4,"contentSha1":"sha1"}`,
+		testFileMetaJSON("large", "name", "none"),
+	)
+	bucket := testBucket()
+	bucket.B2.client = rc
+
+	fm, err := bucket.StartLargeFile("name", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	u, err := bucket.GetUploadPartURL(fm.ID)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	p, err := bucket.UploadPart(u, 1, []byte("cats"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	fm, err = bucket.FinishLargeFile(fm.ID, []string{p.ContentSha1})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if fm.ID != "large" || fm.Bucket != bucket {
+		t.Errorf("Expected the finished file, instead got %+v", fm)
+	}
+	checkPaths(rc, []string{"b2_start_large_file", "b2_get_upload_part_url", "/part", "b2_finish_large_file"}, t)
+
+	body, _ := ioutil.ReadAll(rc.Requests[3].Body)
+	if string(body) != `{"fileId":"large","partSha1Array":["sha1"]}` {
+		t.Errorf("Expected the part sha1s, instead got %s", body)
+	}
+}
+
+func TestBucket_CancelLargeFile(t *testing.T) {
+	bucket := testBucket()
+	if err := bucket.CancelLargeFile(""); err == nil {
+		t.Error("Expected no fileID to fail")
+	}
+	err := bucket.CancelLargeFile("large")
+	checkAPIError(err, 400, t)
+	req := bucket.B2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"fileId":"large"}` {
+		t.Errorf(`Expected body to be {"fileId":"large"}, instead got %s`, body)
+	}
+}
@@ -0,0 +1,127 @@
+package b2
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LifecycleRule tells B2 to automatically hide and then delete files whose
+// names begin with FileNamePrefix.
+//
+// A zero number of days means the rule never takes that step.
+type LifecycleRule struct {
+	FileNamePrefix            string `json:"fileNamePrefix"`
+	DaysFromUploadingToHiding int64  `json:"daysFromUploadingToHiding,omitempty"`
+	DaysFromHidingToDeleting  int64  `json:"daysFromHidingToDeleting,omitempty"`
+}
+
+// LifecycleReport lists the file versions that a set of lifecycle rules
+// would act on.
+type LifecycleReport struct {
+	Hide   []FileMeta
+	Delete []FileMeta
+}
+
+// ValidateLifecycleRules checks a set of rules before they are sent to B2.
+//
+// Every rule must hide or delete something, the days must not be negative,
+// and no rule's prefix may be a prefix of another rule's prefix, since B2
+// applies at most one rule to each file.
+func ValidateLifecycleRules(rules []LifecycleRule) error {
+	for i, r := range rules {
+		if r.DaysFromUploadingToHiding < 0 || r.DaysFromHidingToDeleting < 0 {
+			return fmt.Errorf("Lifecycle rule %q has negative days", r.FileNamePrefix)
+		}
+		if r.DaysFromUploadingToHiding == 0 && r.DaysFromHidingToDeleting == 0 {
+			return fmt.Errorf("Lifecycle rule %q does nothing", r.FileNamePrefix)
+		}
+		for _, other := range rules[i+1:] {
+			if strings.HasPrefix(r.FileNamePrefix, other.FileNamePrefix) ||
+				strings.HasPrefix(other.FileNamePrefix, r.FileNamePrefix) {
+				return fmt.Errorf("Lifecycle rule prefixes %q and %q overlap", r.FileNamePrefix, other.FileNamePrefix)
+			}
+		}
+	}
+	return nil
+}
+
+// EvaluateLifecycleRules reports which files in the bucket the rules would
+// hide or delete if they were applied at the given time. Nothing is changed.
+//
+// Every file version in the bucket is listed to build the report.
+func (b *Bucket) EvaluateLifecycleRules(rules []LifecycleRule, now time.Time) (*LifecycleReport, error) {
+	if err := ValidateLifecycleRules(rules); err != nil {
+		return nil, err
+	}
+	versions, err := b.allVersions()
+	if err != nil {
+		return nil, err
+	}
+	return evaluateLifecycle(rules, versions, now), nil
+}
+
+// evaluateLifecycle applies rules to versions, which must be in the order
+// B2 lists them: by name, then newest first.
+//
+// The current version of a file is hidden once it is old enough. Older
+// versions and hide markers are deleted once they have been hidden for long
+// enough.
+func evaluateLifecycle(rules []LifecycleRule, versions []FileMeta, now time.Time) *LifecycleReport {
+	report := &LifecycleReport{}
+	nowMillis := now.UnixNano() / int64(time.Millisecond)
+	day := int64(24 * time.Hour / time.Millisecond)
+
+	for i, v := range versions {
+		rule, ok := matchLifecycleRule(rules, v.Name)
+		if !ok || v.Action == ActionStart {
+			continue
+		}
+		current := i == 0 || versions[i-1].Name != v.Name
+
+		if current && v.Action == ActionUpload {
+			if rule.DaysFromUploadingToHiding > 0 &&
+				nowMillis >= v.UploadTimestamp+rule.DaysFromUploadingToHiding*day {
+				report.Hide = append(report.Hide, v)
+			}
+			continue
+		}
+
+		hiddenAt := v.UploadTimestamp
+		if !current {
+			hiddenAt = versions[i-1].UploadTimestamp
+		}
+		if rule.DaysFromHidingToDeleting > 0 &&
+			nowMillis >= hiddenAt+rule.DaysFromHidingToDeleting*day {
+			report.Delete = append(report.Delete, v)
+		}
+	}
+	return report
+}
+
+// matchLifecycleRule returns the rule that applies to a file name, if any.
+func matchLifecycleRule(rules []LifecycleRule, name string) (LifecycleRule, bool) {
+	for _, r := range rules {
+		if strings.HasPrefix(name, r.FileNamePrefix) {
+			return r, true
+		}
+	}
+	return LifecycleRule{}, false
+}
+
+// allVersions returns the FileMeta of every file version in the bucket.
+func (b *Bucket) allVersions() ([]FileMeta, error) {
+	versions := []FileMeta{}
+	nextName, nextID := "", ""
+	for {
+		lfr, err := b.ListFileVersions(nextName, nextID, 1000)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, lfr.Files...)
+		if lfr.NextFileName == "" {
+			return versions, nil
+		}
+		nextName, nextID = lfr.NextFileName, lfr.NextFileID
+	}
+}
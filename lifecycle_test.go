@@ -0,0 +1,96 @@
+package b2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateLifecycleRules(t *testing.T) {
+	cases := []struct {
+		rules []LifecycleRule
+		valid bool
+	}{
+		{rules: nil, valid: true},
+		{rules: []LifecycleRule{{FileNamePrefix: "logs/", DaysFromHidingToDeleting: 1}}, valid: true},
+		{rules: []LifecycleRule{
+			{FileNamePrefix: "logs/", DaysFromUploadingToHiding: 1},
+			{FileNamePrefix: "tmp/", DaysFromHidingToDeleting: 1},
+		}, valid: true},
+		{rules: []LifecycleRule{{FileNamePrefix: "logs/"}}, valid: false},
+		{rules: []LifecycleRule{{FileNamePrefix: "logs/", DaysFromHidingToDeleting: -1}}, valid: false},
+		{rules: []LifecycleRule{
+			{FileNamePrefix: "logs/", DaysFromHidingToDeleting: 1},
+			{FileNamePrefix: "logs/old/", DaysFromHidingToDeleting: 1},
+		}, valid: false},
+		{rules: []LifecycleRule{
+			{FileNamePrefix: "a", DaysFromHidingToDeleting: 1},
+			{FileNamePrefix: "a", DaysFromHidingToDeleting: 2},
+		}, valid: false},
+		{rules: []LifecycleRule{
+			{FileNamePrefix: "", DaysFromHidingToDeleting: 1},
+			{FileNamePrefix: "tmp/", DaysFromHidingToDeleting: 1},
+		}, valid: false},
+	}
+
+	for i, c := range cases {
+		err := ValidateLifecycleRules(c.rules)
+		if c.valid && err != nil {
+			t.Errorf("Expected no error, instead got %s, case %d", err, i)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("Expected an error, case %d", i)
+		}
+	}
+}
+
+func TestEvaluateLifecycle(t *testing.T) {
+	day := int64(24 * time.Hour / time.Millisecond)
+	now := time.Unix(0, 100*day*int64(time.Millisecond))
+	rules := []LifecycleRule{
+		{FileNamePrefix: "logs/", DaysFromUploadingToHiding: 10, DaysFromHidingToDeleting: 5},
+	}
+	versions := []FileMeta{
+		{ID: "1", Name: "logs/a", Action: ActionUpload, UploadTimestamp: 95 * day}, // current, too new to hide
+		{ID: "2", Name: "logs/a", Action: ActionUpload, UploadTimestamp: 90 * day}, // hidden at 95, delete at 100
+		{ID: "3", Name: "logs/a", Action: ActionUpload, UploadTimestamp: 80 * day}, // hidden at 90
+		{ID: "4", Name: "logs/b", Action: ActionUpload, UploadTimestamp: 89 * day}, // current, old enough to hide
+		{ID: "5", Name: "logs/c", Action: ActionHide, UploadTimestamp: 99 * day},   // marker, too new
+		{ID: "6", Name: "logs/c", Action: ActionUpload, UploadTimestamp: 10 * day}, // hidden at 99
+		{ID: "7", Name: "logs/d", Action: ActionStart, UploadTimestamp: 1 * day},   // unfinished
+		{ID: "8", Name: "other", Action: ActionUpload, UploadTimestamp: 1 * day},   // no rule
+	}
+
+	report := evaluateLifecycle(rules, versions, now)
+
+	if len(report.Hide) != 1 || report.Hide[0].ID != "4" {
+		t.Errorf("Expected to hide file 4, instead got %+v", report.Hide)
+	}
+	if len(report.Delete) != 2 {
+		t.Fatalf("Expected to delete 2 files, instead got %+v", report.Delete)
+	}
+	if report.Delete[0].ID != "2" || report.Delete[1].ID != "3" {
+		t.Errorf("Expected to delete files 2 and 3, instead got %s and %s", report.Delete[0].ID, report.Delete[1].ID)
+	}
+}
+
+func TestBucket_EvaluateLifecycleRules(t *testing.T) {
+	bucket := testBucket()
+	report, err := bucket.EvaluateLifecycleRules([]LifecycleRule{{FileNamePrefix: "a"}}, time.Now())
+	if err == nil {
+		t.Error("Expected invalid rules to fail")
+	}
+	if report != nil {
+		t.Errorf("Expected report to be nil, instead got %+v", report)
+	}
+
+	rc := testReplayClient(testListJSON(testFileMetaJSON("id0", "a", "sha1")))
+	bucket.B2.client = rc
+	report, err = bucket.EvaluateLifecycleRules([]LifecycleRule{{FileNamePrefix: "a", DaysFromUploadingToHiding: 1}}, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(report.Hide) != 1 {
+		t.Errorf("Expected to hide one file, instead got %+v", report.Hide)
+	}
+	checkPaths(rc, []string{"b2_list_file_versions"}, t)
+}
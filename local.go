@@ -0,0 +1,197 @@
+package b2
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LocalDownloadOptions are the optional settings of a download to a local
+// file.
+type LocalDownloadOptions struct {
+	// Encryption must hold the customer key to download a file that was
+	// uploaded with SSE-C.
+	Encryption *Encryption
+
+	// RestoreModTime sets the modified time of the local file to the
+	// file's src_last_modified_millis, or its upload time if it has none.
+	RestoreModTime bool
+}
+
+// UploadLocalFile uploads the local file at path as name. The file is
+// streamed with a Writer, so large files are uploaded in parts without being
+// read into memory.
+//
+// The file's modified time is stored as src_last_modified_millis, and if no
+// ContentType is given it is guessed from the file's extension. A file large
+// enough to be uploaded in parts is read once beforehand to find its sha1,
+// which is stored as large_file_sha1.
+//
+// Files uploaded with Compression are read into memory, as the Writer
+// doesn't support it.
+func (b *Bucket) UploadLocalFile(path, name string, opts *UploadOptions) (*FileMeta, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	uopts := UploadOptions{}
+	if opts != nil {
+		uopts = *opts
+	}
+	fileInfo := map[string]string{}
+	for k, v := range uopts.FileInfo {
+		fileInfo[k] = v
+	}
+	fileInfo["src_last_modified_millis"] = strconv.FormatInt(info.ModTime().UnixNano()/1e6, 10)
+	if info.Size() > DefaultPartSize && uopts.Compression == nil {
+		sum, err := localSha1(path)
+		if err != nil {
+			return nil, err
+		}
+		fileInfo["large_file_sha1"] = sum
+	}
+	uopts.FileInfo = fileInfo
+	if uopts.ContentType == "" {
+		uopts.ContentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+
+	if uopts.Compression != nil {
+		return b.UploadFileWithOptions(name, f, &uopts)
+	}
+	w := b.NewWriter(name, &uopts)
+	if _, err := io.Copy(w, f); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return w.Meta(), nil
+}
+
+// DownloadLocalFile downloads the current version of the named file to the
+// local path, returning its FileMeta.
+//
+// The file is streamed to a temporary file in the same directory, which
+// replaces path only once its size and sha1 have been checked.
+func (b *Bucket) DownloadLocalFile(name, path string, opts *LocalDownloadOptions) (*FileMeta, error) {
+	meta, err := b.currentFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.downloadLocalFile(meta, path, opts)
+}
+
+// DownloadLocalFileByID downloads a file version given its ID to the local
+// path, like DownloadLocalFile.
+func (b *Bucket) DownloadLocalFileByID(id, path string, opts *LocalDownloadOptions) (*FileMeta, error) {
+	meta, err := b.GetFileInfo(id)
+	if err != nil {
+		return nil, err
+	}
+	return b.downloadLocalFile(*meta, path, opts)
+}
+
+func (b *Bucket) downloadLocalFile(meta FileMeta, path string, opts *LocalDownloadOptions) (*FileMeta, error) {
+	if opts == nil {
+		opts = &LocalDownloadOptions{}
+	}
+	if err := opts.Encryption.validate(); err != nil {
+		return nil, err
+	}
+	if meta.Action != ActionUpload {
+		return nil, fmt.Errorf("File %s is not an uploaded file", meta.Name)
+	}
+	if err := b.downloadLocal(meta, path, opts.Encryption, opts.RestoreModTime); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// downloadLocal streams a file to localPath, checking its size and sha1 and
+// optionally setting its modified time. The file is written to a temporary
+// file in the same directory, which replaces localPath once it's complete.
+func (b *Bucket) downloadLocal(meta FileMeta, localPath string, enc *Encryption, restoreModTime bool) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := createTemp(filepath.Dir(localPath), ".b2-download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	r := &streamReader{bucket: b, meta: &meta, enc: enc}
+	defer r.Close()
+	h := sha1.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if n != meta.ContentLength {
+		return fmt.Errorf("Downloaded %d bytes of %s, expected %d", n, meta.Name, meta.ContentLength)
+	}
+	if sum := fileSha1(&meta); sum != "" && sum != fmt.Sprintf("%x", h.Sum(nil)) {
+		return fmt.Errorf("File sha1 didn't match provided sha1")
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return err
+	}
+	if !restoreModTime {
+		return nil
+	}
+	modTime := time.Unix(0, remoteModTime(&meta)*int64(time.Millisecond))
+	return os.Chtimes(localPath, modTime, modTime)
+}
+
+// createTemp creates a new file in dir with a random name starting with
+// prefix. Unlike ioutil.TempFile, the file is created 0644, masked by the
+// umask, so a downloaded file gets the same permissions as one created with
+// os.Create.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; i < 100; i++ {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		name := filepath.Join(dir, prefix+hex.EncodeToString(b))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+	return nil, fmt.Errorf("Couldn't create a temporary file in %s", dir)
+}
+
+func localSha1(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,152 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucket_UploadLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Unix(1500000000, 123000000)
+	testWriteFile(t, dir, "page.html", "<p>hi</p>", modTime)
+	testWriteFile(t, dir, "data.bin", "abc", modTime)
+	bucket, fake := testFakeBucket()
+
+	fm, err := bucket.UploadLocalFile(filepath.Join(dir, "page.html"), "site/page.html", &UploadOptions{FileInfo: map[string]string{"owner": "ops"}})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if fm.FileInfo["src_last_modified_millis"] != "1500000000123" || fm.FileInfo["owner"] != "ops" {
+		t.Errorf("Expected the mod time and file info to be stored, instead got %+v", fm.FileInfo)
+	}
+	if !strings.HasPrefix(fm.ContentType, "text/html") {
+		t.Errorf("Expected the content type to be guessed, instead got %s", fm.ContentType)
+	}
+	if data, _ := fake.data("id", "site/page.html"); string(data) != "<p>hi</p>" {
+		t.Errorf("Expected the file to be uploaded, instead got %q", data)
+	}
+
+	fm, err = bucket.UploadLocalFile(filepath.Join(dir, "data.bin"), "data.bin", &UploadOptions{ContentType: "application/x-custom"})
+	if err != nil || fm.ContentType != "application/x-custom" {
+		t.Errorf("Expected the given content type to be kept, instead got %+v with %v", fm, err)
+	}
+
+	fm, err = bucket.UploadLocalFile(filepath.Join(dir, "page.html"), "page.html.gz", &UploadOptions{Compression: Gzip})
+	if err != nil || fm.FileInfo["src_last_modified_millis"] != "1500000000123" {
+		t.Errorf("Expected a compressed upload to keep the mod time, instead got %+v with %v", fm, err)
+	}
+
+	if _, err := bucket.UploadLocalFile(filepath.Join(dir, "missing"), "missing", nil); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+	if _, err := bucket.UploadLocalFile(dir, "dir", nil); err == nil {
+		t.Error("Expected a directory to fail")
+	}
+}
+
+func TestBucket_DownloadLocalFile(t *testing.T) {
+	dir := t.TempDir()
+	bucket, fake := testFakeBucket()
+	meta := fake.put("id", "a/b.txt", []byte("hello"), map[string]string{"src_last_modified_millis": "1400000000000"})
+
+	p := filepath.Join(dir, "sub", "b.txt")
+	fm, err := bucket.DownloadLocalFile("a/b.txt", p, &LocalDownloadOptions{RestoreModTime: true})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if fm.ID != meta.ID {
+		t.Errorf("Expected file %s, instead got %s", meta.ID, fm.ID)
+	}
+	if data, _ := ioutil.ReadFile(p); string(data) != "hello" {
+		t.Errorf("Expected the file to be downloaded, instead got %q", data)
+	}
+	info, _ := os.Stat(p)
+	if !info.ModTime().Equal(time.Unix(1400000000, 0)) {
+		t.Errorf("Expected the mod time to be restored, instead got %s", info.ModTime())
+	}
+
+	p = filepath.Join(dir, "byid.txt")
+	if _, err := bucket.DownloadLocalFileByID(meta.ID, p, nil); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	info, _ = os.Stat(p)
+	if info.ModTime().Equal(time.Unix(1400000000, 0)) {
+		t.Error("Expected the mod time not to be restored by default")
+	}
+
+	if _, err := bucket.DownloadLocalFile("missing", p, nil); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+	hidden := fake.add("id", "hidden", ActionHide, nil, nil)
+	if _, err := bucket.DownloadLocalFileByID(hidden.ID, p, nil); err == nil {
+		t.Error("Expected a hide marker to fail")
+	}
+}
+
+func TestBucket_downloadLocal_permissions(t *testing.T) {
+	dir := t.TempDir()
+	bucket, fake := testFakeBucket()
+	meta := fake.put("id", "file", []byte("data"), nil)
+
+	// a file written directly with 0644 shows the umask in effect
+	probe := filepath.Join(dir, "probe")
+	if err := ioutil.WriteFile(probe, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := os.Stat(probe)
+
+	p := filepath.Join(dir, "file")
+	if err := bucket.downloadLocal(meta, p, nil, false); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	info, _ := os.Stat(p)
+	if info.Mode().Perm() != expected.Mode().Perm() {
+		t.Errorf("Expected mode %s, instead got %s", expected.Mode().Perm(), info.Mode().Perm())
+	}
+}
+
+func TestBucket_UploadLocalFile_roundTrip(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Unix(1600000000, 0)
+	testWriteFile(t, dir, "in.txt", "round trip", modTime)
+	bucket, _ := testFakeBucket()
+
+	if _, err := bucket.UploadLocalFile(filepath.Join(dir, "in.txt"), "f.txt", nil); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	out := filepath.Join(dir, "out.txt")
+	if _, err := bucket.DownloadLocalFile("f.txt", out, &LocalDownloadOptions{RestoreModTime: true}); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	in, _ := ioutil.ReadFile(filepath.Join(dir, "in.txt"))
+	data, _ := ioutil.ReadFile(out)
+	info, _ := os.Stat(out)
+	if !bytes.Equal(in, data) || !info.ModTime().Equal(modTime) {
+		t.Errorf("Expected the file and its mod time to round trip, instead got %q at %s", data, info.ModTime())
+	}
+}
+
+func TestBucket_downloadLocal_sha1Mismatch(t *testing.T) {
+	dir := t.TempDir()
+	testWriteFile(t, dir, "file", "original", time.Now())
+	bucket, fake := testFakeBucket()
+	meta := fake.put("id", "file", []byte("tampered"), nil)
+	meta.ContentSha1 = "0000000000000000000000000000000000000000"
+
+	if err := bucket.downloadLocal(meta, filepath.Join(dir, "file"), nil, false); err == nil {
+		t.Fatal("Expected a sha1 mismatch to fail")
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "file"))
+	if string(data) != "original" {
+		t.Errorf("Expected the local file to be untouched, instead got %q", data)
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, instead got %d files", len(entries))
+	}
+}
@@ -0,0 +1,231 @@
+package b2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// RetentionMode is how strictly a file's retention is enforced.
+type RetentionMode string
+
+// Governance retention may be shortened or removed by keys with the
+// bypassGovernance capability. Compliance retention may only be extended.
+const (
+	RetentionNone       RetentionMode = ""
+	RetentionGovernance RetentionMode = "governance"
+	RetentionCompliance RetentionMode = "compliance"
+)
+
+// LegalHold prevents a file from being deleted while it is on.
+type LegalHold string
+
+// A LegalHold may be on or off.
+const (
+	LegalHoldOn  LegalHold = "on"
+	LegalHoldOff LegalHold = "off"
+)
+
+// FileRetention keeps a file from being deleted or overwritten until
+// RetainUntilTimestamp, in milliseconds since the epoch.
+type FileRetention struct {
+	Mode                 RetentionMode `json:"mode,omitempty"`
+	RetainUntilTimestamp int64         `json:"retainUntilTimestamp,omitempty"`
+}
+
+// FileRetentionInfo is the retention of a file, as B2 reports it.
+//
+// Value is nil if the application key isn't allowed to read it.
+type FileRetentionInfo struct {
+	IsClientAuthorizedToRead bool           `json:"isClientAuthorizedToRead"`
+	Value                    *FileRetention `json:"value"`
+}
+
+// LegalHoldInfo is the legal hold of a file, as B2 reports it.
+type LegalHoldInfo struct {
+	IsClientAuthorizedToRead bool      `json:"isClientAuthorizedToRead"`
+	Value                    LegalHold `json:"value"`
+}
+
+// RetentionPeriod is a length of time in "days" or "years".
+type RetentionPeriod struct {
+	Duration int64  `json:"duration"`
+	Unit     string `json:"unit"`
+}
+
+// DefaultRetention is applied to files uploaded to a bucket with file lock
+// enabled, when they don't set their own retention.
+type DefaultRetention struct {
+	Mode   RetentionMode    `json:"mode,omitempty"`
+	Period *RetentionPeriod `json:"period,omitempty"`
+}
+
+// FileLockConfiguration is the file lock state of a bucket.
+type FileLockConfiguration struct {
+	IsClientAuthorizedToRead bool `json:"isClientAuthorizedToRead"`
+	Value                    *struct {
+		DefaultRetention  DefaultRetention `json:"defaultRetention"`
+		IsFileLockEnabled bool             `json:"isFileLockEnabled"`
+	} `json:"value"`
+}
+
+// updateRetentionRequest is used for changing a file's retention.
+type updateRetentionRequest struct {
+	FileName         string        `json:"fileName"`
+	FileID           string        `json:"fileId"`
+	FileRetention    FileRetention `json:"fileRetention"`
+	BypassGovernance bool          `json:"bypassGovernance,omitempty"`
+}
+
+// updateLegalHoldRequest is used for changing a file's legal hold.
+type updateLegalHoldRequest struct {
+	FileName  string    `json:"fileName"`
+	FileID    string    `json:"fileId"`
+	LegalHold LegalHold `json:"legalHold"`
+}
+
+// UpdateFileRetention sets the retention of a file version.
+//
+// Governance retention may only be shortened or removed by setting
+// bypassGovernance, which requires a key with that capability. An empty
+// FileRetention removes governance retention.
+func (b *Bucket) UpdateFileRetention(fileName, fileID string, r FileRetention, bypassGovernance bool) (*FileRetention, error) {
+	if fileName == "" {
+		return nil, fmt.Errorf("fileName must be provided")
+	}
+	if fileID == "" {
+		return nil, fmt.Errorf("fileID must be provided")
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	urr := updateRetentionRequest{
+		FileName:         fileName,
+		FileID:           fileID,
+		FileRetention:    r,
+		BypassGovernance: bypassGovernance,
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_update_file_retention", urr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return parseUpdateFileRetention(resp)
+}
+
+func parseUpdateFileRetention(resp *http.Response) (*FileRetention, error) {
+	urr := &updateRetentionRequest{}
+	err := parseResponse(resp, urr)
+	if err != nil {
+		return nil, err
+	}
+	return &urr.FileRetention, nil
+}
+
+// UpdateFileLegalHold turns the legal hold of a file version on or off.
+func (b *Bucket) UpdateFileLegalHold(fileName, fileID string, hold LegalHold) (LegalHold, error) {
+	if fileName == "" {
+		return "", fmt.Errorf("fileName must be provided")
+	}
+	if fileID == "" {
+		return "", fmt.Errorf("fileID must be provided")
+	}
+	if hold != LegalHoldOn && hold != LegalHoldOff {
+		return "", fmt.Errorf("Legal hold must be on or off, not %q", hold)
+	}
+
+	ulr := updateLegalHoldRequest{
+		FileName:  fileName,
+		FileID:    fileID,
+		LegalHold: hold,
+	}
+	req, err := CreateRequest("POST", b.B2.APIURL+"/b2api/v1/b2_update_file_legal_hold", ulr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", b.B2.AuthorizationToken)
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	return parseUpdateFileLegalHold(resp)
+}
+
+func parseUpdateFileLegalHold(resp *http.Response) (LegalHold, error) {
+	ulr := &updateLegalHoldRequest{}
+	err := parseResponse(resp, ulr)
+	if err != nil {
+		return "", err
+	}
+	return ulr.LegalHold, nil
+}
+
+// validate checks that a retention has a known mode and, if it has a mode,
+// a time to retain until.
+func (r FileRetention) validate() error {
+	switch r.Mode {
+	case RetentionNone:
+		if r.RetainUntilTimestamp != 0 {
+			return fmt.Errorf("Retention without a mode can't have a retain until time")
+		}
+	case RetentionGovernance, RetentionCompliance:
+		if r.RetainUntilTimestamp <= 0 {
+			return fmt.Errorf("Retention mode %s needs a retain until time", r.Mode)
+		}
+	default:
+		return fmt.Errorf("Unknown retention mode %s", r.Mode)
+	}
+	return nil
+}
+
+// validate checks that a default retention has a known mode, and a period
+// in days or years.
+func (r *DefaultRetention) validate() error {
+	if r == nil || r.Mode == RetentionNone {
+		return nil
+	}
+	if r.Mode != RetentionGovernance && r.Mode != RetentionCompliance {
+		return fmt.Errorf("Unknown retention mode %s", r.Mode)
+	}
+	if r.Period == nil || r.Period.Duration <= 0 {
+		return fmt.Errorf("Default retention needs a positive period")
+	}
+	if r.Period.Unit != "days" && r.Period.Unit != "years" {
+		return fmt.Errorf("Default retention period must be in days or years, not %q", r.Period.Unit)
+	}
+	return nil
+}
+
+// setLockHeaders sets the retention and legal hold headers of an upload.
+func setLockHeaders(h http.Header, r *FileRetention, hold LegalHold) {
+	if r != nil && r.Mode != RetentionNone {
+		h.Set("X-Bz-File-Retention-Mode", string(r.Mode))
+		h.Set("X-Bz-File-Retention-Retain-Until-Timestamp", strconv.FormatInt(r.RetainUntilTimestamp, 10))
+	}
+	if hold != "" {
+		h.Set("X-Bz-File-Legal-Hold", string(hold))
+	}
+}
+
+// lockFromHeaders returns the retention and legal hold that a download
+// response reports.
+func lockFromHeaders(h http.Header) (*FileRetentionInfo, *LegalHoldInfo) {
+	var retention *FileRetentionInfo
+	var hold *LegalHoldInfo
+	if mode := h.Get("X-Bz-File-Retention-Mode"); mode != "" {
+		until, _ := strconv.ParseInt(h.Get("X-Bz-File-Retention-Retain-Until-Timestamp"), 10, 64)
+		retention = &FileRetentionInfo{
+			IsClientAuthorizedToRead: true,
+			Value:                    &FileRetention{Mode: RetentionMode(mode), RetainUntilTimestamp: until},
+		}
+	}
+	if v := h.Get("X-Bz-File-Legal-Hold"); v != "" {
+		hold = &LegalHoldInfo{IsClientAuthorizedToRead: true, Value: LegalHold(v)}
+	}
+	return retention, hold
+}
@@ -0,0 +1,172 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestBucket_UpdateFileRetention(t *testing.T) {
+	bucket := testBucket()
+	retention := FileRetention{Mode: RetentionGovernance, RetainUntilTimestamp: 1700000000000}
+
+	cases := map[string]struct {
+		name, id string
+		r        FileRetention
+	}{
+		"no name":    {name: "", id: "id", r: retention},
+		"no id":      {name: "name", id: "", r: retention},
+		"bad mode":   {name: "name", id: "id", r: FileRetention{Mode: "forever", RetainUntilTimestamp: 1}},
+		"no time":    {name: "name", id: "id", r: FileRetention{Mode: RetentionCompliance}},
+		"time alone": {name: "name", id: "id", r: FileRetention{RetainUntilTimestamp: 1}},
+	}
+	for name, c := range cases {
+		r, err := bucket.UpdateFileRetention(c.name, c.id, c.r, false)
+		if err == nil {
+			t.Errorf("Expected an error, case %s", name)
+		}
+		if r != nil {
+			t.Errorf("Expected r to be nil, instead got %+v, case %s", r, name)
+		}
+	}
+
+	bucket.UpdateFileRetention("name", "id", retention, true)
+	req := bucket.B2.client.(*testClient).Request
+	auth, ok := req.Header["Authorization"]
+	if !ok || auth[0] != bucket.B2.AuthorizationToken {
+		t.Errorf("Expected auth to be %s, instead got %s", bucket.B2.AuthorizationToken, auth)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	expected := `{"fileName":"name","fileId":"id","fileRetention":{"mode":"governance",` +
+		`"retainUntilTimestamp":1700000000000},"bypassGovernance":true}`
+	if string(body) != expected {
+		t.Errorf("Expected body to be %s, instead got %s", expected, body)
+	}
+}
+
+func TestParseUpdateFileRetention(t *testing.T) {
+	resp := testResponse(200, `{"fileId":"id","fileName":"name","fileRetention":{"mode":"compliance","retainUntilTimestamp":5}}`)
+	r, err := parseUpdateFileRetention(resp)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if r.Mode != RetentionCompliance || r.RetainUntilTimestamp != 5 {
+		t.Errorf("Expected compliance until 5, instead got %+v", r)
+	}
+
+	for i, resp := range testAPIErrors() {
+		r, err := parseUpdateFileRetention(resp)
+		checkAPIError(err, 400+i, t)
+		if r != nil {
+			t.Errorf("Expected r to be nil, instead got %+v", r)
+		}
+	}
+}
+
+func TestBucket_UpdateFileLegalHold(t *testing.T) {
+	bucket := testBucket()
+	if _, err := bucket.UpdateFileLegalHold("name", "id", "maybe"); err == nil {
+		t.Error("Expected an unknown legal hold to fail")
+	}
+
+	bucket.UpdateFileLegalHold("name", "id", LegalHoldOn)
+	req := bucket.B2.client.(*testClient).Request
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != `{"fileName":"name","fileId":"id","legalHold":"on"}` {
+		t.Errorf("Expected legal hold request body, instead got %s", body)
+	}
+
+	hold, err := parseUpdateFileLegalHold(testResponse(200, `{"fileId":"id","fileName":"name","legalHold":"off"}`))
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if hold != LegalHoldOff {
+		t.Errorf("Expected legal hold to be off, instead got %s", hold)
+	}
+}
+
+func TestBucket_UploadFileWithOptions_lock(t *testing.T) {
+	bucket := testBucket()
+	bucket.UploadURLs = []*UploadURL{testUploadURL()}
+	opts := &UploadOptions{
+		Retention: &FileRetention{Mode: RetentionGovernance, RetainUntilTimestamp: 42},
+		LegalHold: LegalHoldOn,
+	}
+	req, err := bucket.setupUploadFile("name", bytes.NewReader([]byte("cats")), opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	checks := map[string]string{
+		"X-Bz-File-Retention-Mode":                   "governance",
+		"X-Bz-File-Retention-Retain-Until-Timestamp": "42",
+		"X-Bz-File-Legal-Hold":                       "on",
+	}
+	for k, v := range checks {
+		if req.Header.Get(k) != v {
+			t.Errorf("Expected header %s to be %s, instead got %s", k, v, req.Header.Get(k))
+		}
+	}
+
+	_, err = bucket.UploadFileWithOptions("name", bytes.NewReader([]byte("cats")), &UploadOptions{LegalHold: "yes"})
+	if err == nil {
+		t.Error("Expected an unknown legal hold to fail")
+	}
+}
+
+func TestLockFromHeaders(t *testing.T) {
+	retention, hold := lockFromHeaders(http.Header{})
+	if retention != nil || hold != nil {
+		t.Errorf("Expected no lock state, instead got %+v and %+v", retention, hold)
+	}
+
+	retention, hold = lockFromHeaders(http.Header{
+		"X-Bz-File-Retention-Mode":                   {"compliance"},
+		"X-Bz-File-Retention-Retain-Until-Timestamp": {"42"},
+		"X-Bz-File-Legal-Hold":                       {"off"},
+	})
+	if retention == nil || retention.Value.Mode != RetentionCompliance || retention.Value.RetainUntilTimestamp != 42 {
+		t.Errorf("Expected compliance until 42, instead got %+v", retention)
+	}
+	if hold == nil || hold.Value != LegalHoldOff {
+		t.Errorf("Expected legal hold off, instead got %+v", hold)
+	}
+}
+
+func TestB2_CreateBucketWithOptions_fileLock(t *testing.T) {
+	b2 := testB2()
+	rc := testReplayClient(
+		`{"bucketId":"id","bucketName":"name","bucketType":"allPrivate"}`,
+		`{"bucketId":"id","bucketName":"name","bucketType":"allPrivate","fileLockConfiguration":`+
+			`{"isClientAuthorizedToRead":true,"value":{"defaultRetention":{"mode":"governance",`+
+			`"period":{"duration":7,"unit":"days"}},"isFileLockEnabled":true}}}`,
+	)
+	b2.client = rc
+	opts := &BucketOptions{
+		FileLockEnabled:  true,
+		DefaultRetention: &DefaultRetention{Mode: RetentionGovernance, Period: &RetentionPeriod{Duration: 7, Unit: "days"}},
+	}
+
+	bucket, err := b2.CreateBucketWithOptions("name", AllPrivate, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	checkPaths(rc, []string{"b2_create_bucket", "b2_update_bucket"}, t)
+
+	create, _ := ioutil.ReadAll(rc.Requests[0].Body)
+	if !bytes.Contains(create, []byte(`"fileLockEnabled":true`)) || bytes.Contains(create, []byte("defaultRetention")) {
+		t.Errorf("Expected create to only enable file lock, instead got %s", create)
+	}
+	update, _ := ioutil.ReadAll(rc.Requests[1].Body)
+	if !bytes.Contains(update, []byte(`"defaultRetention":{"mode":"governance","period":{"duration":7,"unit":"days"}}`)) {
+		t.Errorf("Expected update to set default retention, instead got %s", update)
+	}
+	if bucket.FileLock == nil || !bucket.FileLock.Value.IsFileLockEnabled {
+		t.Errorf("Expected file lock to be enabled, instead got %+v", bucket.FileLock)
+	}
+
+	bad := &BucketOptions{DefaultRetention: &DefaultRetention{Mode: RetentionGovernance, Period: &RetentionPeriod{Duration: 1, Unit: "weeks"}}}
+	if _, err := b2.CreateBucketWithOptions("name", AllPrivate, bad); err == nil {
+		t.Error("Expected a retention period in weeks to fail")
+	}
+}
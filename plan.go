@@ -0,0 +1,396 @@
+package b2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// PlanOp is an action a Plan takes on a file.
+type PlanOp string
+
+// Files are uploaded, downloaded and copied before any are hidden or
+// deleted.
+const (
+	PlanUpload        PlanOp = "upload"
+	PlanDownload      PlanOp = "download"
+	PlanCopy          PlanOp = "copy"
+	PlanHide          PlanOp = "hide"
+	PlanDeleteVersion PlanOp = "delete version"
+	PlanDeleteLocal   PlanOp = "delete local"
+)
+
+// destructive reports whether an op removes or hides data, so that it runs
+// after the ops that write data.
+func (op PlanOp) destructive() bool {
+	return op == PlanHide || op == PlanDeleteVersion || op == PlanDeleteLocal
+}
+
+// PlanAction is one action of a Plan.
+type PlanAction struct {
+	Op PlanOp `json:"op"`
+
+	// Name is the file acted on, which is a local path for downloads and
+	// local deletes.
+	Name string `json:"name"`
+
+	// Source is what is uploaded, downloaded or copied to Name.
+	Source string `json:"source,omitempty"`
+
+	// FileID is the version that is copied, downloaded or deleted.
+	FileID string `json:"fileId,omitempty"`
+
+	Size   int64  `json:"size"`
+	Reason string `json:"reason"`
+
+	// Err is set if the action failed once the Plan was executed.
+	Err error `json:"-"`
+
+	run      func(w *planWorker) error
+	requires int // 1 + the index of an action that must succeed first, or 0
+}
+
+// MarshalJSON includes the action's error as a string.
+func (a PlanAction) MarshalJSON() ([]byte, error) {
+	type action PlanAction
+	out := struct {
+		action
+		Error string `json:"error,omitempty"`
+	}{action: action(a)}
+	if a.Err != nil {
+		out.Error = a.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// Plan is a list of actions, such as those of a sync, that can be reviewed
+// before it's executed. Execute takes exactly the planned actions: a file
+// that changes after the plan is made isn't re-planned, and deletes only
+// remove the planned versions.
+type Plan struct {
+	Actions   []PlanAction `json:"actions"`
+	Unchanged int          `json:"unchanged"`
+	Executed  bool         `json:"executed"`
+
+	// Concurrency is the number of actions taken at once. It defaults to
+	// DefaultSyncConcurrency.
+	Concurrency int `json:"-"`
+}
+
+// Size is the total size of the actions of a kind.
+func (p *Plan) Size(op PlanOp) int64 {
+	var size int64
+	for _, a := range p.Actions {
+		if a.Op == op {
+			size += a.Size
+		}
+	}
+	return size
+}
+
+// Failed returns the actions that failed.
+func (p *Plan) Failed() []PlanAction {
+	failed := []PlanAction{}
+	for _, a := range p.Actions {
+		if a.Err != nil {
+			failed = append(failed, a)
+		}
+	}
+	return failed
+}
+
+// String renders the plan as a table of actions followed by a summary.
+func (p *Plan) String() string {
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	for _, a := range p.Actions {
+		name := a.Name
+		if a.Source != "" {
+			name = a.Source + " -> " + a.Name
+		}
+		if a.Op == PlanDeleteVersion {
+			name += " (" + a.FileID + ")"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s", a.Op, name, a.Size, a.Reason)
+		if a.Err != nil {
+			fmt.Fprintf(tw, "\tFAILED: %s", a.Err)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	counts := map[PlanOp]int{}
+	for _, a := range p.Actions {
+		counts[a.Op]++
+	}
+	ops := []string{}
+	for op, n := range counts {
+		ops = append(ops, fmt.Sprintf("%d %s (%d bytes)", n, op, p.Size(op)))
+	}
+	sort.Strings(ops)
+	summary := "nothing to do"
+	if len(ops) > 0 {
+		summary = strings.Join(ops, ", ")
+	}
+	fmt.Fprintf(buf, "%s; %d unchanged", summary, p.Unchanged)
+	if p.Executed {
+		fmt.Fprintf(buf, "; %d failed", len(p.Failed()))
+	}
+	fmt.Fprintln(buf)
+	return buf.String()
+}
+
+// JSON renders the plan as indented JSON.
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// Execute takes the planned actions, recording each action's error. Uploads,
+// downloads and copies are taken before hides and deletes, and an action
+// that depends on another, such as hiding the source of a copy, is skipped
+// if the other failed. The first error is returned.
+//
+// A Plan can only be executed once.
+func (p *Plan) Execute() error {
+	if p.Executed {
+		return fmt.Errorf("Plan was already executed")
+	}
+	p.Executed = true
+
+	workers := p.Concurrency
+	if workers <= 0 {
+		workers = DefaultSyncConcurrency
+	}
+	for _, destructive := range []bool{false, true} {
+		indexes := []int{}
+		for i, a := range p.Actions {
+			if a.Op.destructive() == destructive {
+				indexes = append(indexes, i)
+			}
+		}
+		p.run(indexes, workers)
+	}
+
+	for _, a := range p.Actions {
+		if a.Err != nil {
+			return fmt.Errorf("Failed to %s %s: %s", a.Op, a.Name, a.Err)
+		}
+	}
+	return nil
+}
+
+// run takes the actions at indexes with concurrent workers.
+func (p *Plan) run(indexes []int, workers int) {
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := &planWorker{buckets: map[*Bucket]*Bucket{}}
+			for i := range work {
+				a := &p.Actions[i]
+				if r := a.requires; r > 0 && p.Actions[r-1].Err != nil {
+					a.Err = fmt.Errorf("Skipped because %s %s failed", p.Actions[r-1].Op, p.Actions[r-1].Name)
+					continue
+				}
+				if a.run == nil {
+					a.Err = fmt.Errorf("Action can't be executed")
+					continue
+				}
+				a.Err = a.run(w)
+			}
+		}()
+	}
+	for _, i := range indexes {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// planWorker holds the state of one worker executing a Plan.
+type planWorker struct {
+	buckets map[*Bucket]*Bucket
+}
+
+// bucket returns the worker's copy of b, so that each worker gets its own
+// upload URL.
+func (w *planWorker) bucket(b *Bucket) *Bucket {
+	if c, ok := w.buckets[b]; ok {
+		return c
+	}
+	c := *b
+	c.UploadURLs = nil
+	w.buckets[b] = &c
+	return &c
+}
+
+// deleteVersionActions plans deleting every version of a file, each of
+// which requires the action at requires, if it's not 0.
+func (b *Bucket) deleteVersionActions(name, reason string, requires int) ([]PlanAction, error) {
+	versions, err := b.FileVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	actions := []PlanAction{}
+	for _, v := range versions {
+		actions = append(actions, b.deleteVersionAction(v, reason, requires))
+	}
+	return actions, nil
+}
+
+func (b *Bucket) deleteVersionAction(v FileMeta, reason string, requires int) PlanAction {
+	return PlanAction{
+		Op:       PlanDeleteVersion,
+		Name:     v.Name,
+		FileID:   v.ID,
+		Size:     v.ContentLength,
+		Reason:   reason,
+		requires: requires,
+		run: func(w *planWorker) error {
+			_, err := w.bucket(b).DeleteFileVersion(v.Name, v.ID)
+			return err
+		},
+	}
+}
+
+func (b *Bucket) hideAction(f FileMeta, reason string, requires int) PlanAction {
+	return PlanAction{
+		Op:       PlanHide,
+		Name:     f.Name,
+		Size:     f.ContentLength,
+		Reason:   reason,
+		requires: requires,
+		run: func(w *planWorker) error {
+			_, err := w.bucket(b).HideFile(f.Name)
+			return err
+		},
+	}
+}
+
+// PlanDeletePrefix plans deleting every version of every file starting
+// with prefix, including hidden files.
+func (b *Bucket) PlanDeletePrefix(prefix string) (*Plan, error) {
+	versions, err := b.versionsWithPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	for _, v := range versions {
+		plan.Actions = append(plan.Actions, b.deleteVersionAction(v, "bulk delete", 0))
+	}
+	return plan, nil
+}
+
+// PlanPruneVersions plans deleting all but the newest keep versions of each
+// file starting with prefix. Hide markers count as versions.
+func (b *Bucket) PlanPruneVersions(prefix string, keep int) (*Plan, error) {
+	if keep < 1 {
+		return nil, fmt.Errorf("At least 1 version must be kept, not %d", keep)
+	}
+	versions, err := b.versionsWithPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	seen := map[string]int{}
+	for _, v := range versions {
+		seen[v.Name]++
+		if seen[v.Name] <= keep {
+			if seen[v.Name] == 1 {
+				plan.Unchanged++
+			}
+			continue
+		}
+		reason := fmt.Sprintf("older than the newest %d versions", keep)
+		plan.Actions = append(plan.Actions, b.deleteVersionAction(v, reason, 0))
+	}
+	return plan, nil
+}
+
+// PlanRenamePrefix plans renaming every file starting with oldPrefix to
+// start with newPrefix instead, like RenamePrefix. Each source is hidden,
+// or has its versions deleted, only if its copy succeeds and has the same
+// sha1. The prefixes may not overlap.
+func (b *Bucket) PlanRenamePrefix(oldPrefix, newPrefix string, action SourceAction) (*Plan, error) {
+	if oldPrefix == "" {
+		return nil, fmt.Errorf("No prefix provided")
+	}
+	if oldPrefix == newPrefix {
+		return nil, fmt.Errorf("Source and destination prefixes are the same")
+	}
+	if overlaps(oldPrefix, newPrefix) {
+		return nil, fmt.Errorf("Prefixes %q and %q overlap", oldPrefix, newPrefix)
+	}
+	if action != SourceHide && action != SourceDelete {
+		return nil, fmt.Errorf("Unknown source action %d", action)
+	}
+	files, err := b.listPrefix(oldPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	for _, f := range files {
+		f := f
+		// like RenamePrefix, fail before anything runs if any file can't be
+		// moved
+		if err := movable(f); err != nil {
+			return nil, err
+		}
+		newName := newPrefix + strings.TrimPrefix(f.Name, oldPrefix)
+		plan.Actions = append(plan.Actions, PlanAction{
+			Op:     PlanCopy,
+			Name:   newName,
+			Source: f.Name,
+			FileID: f.ID,
+			Size:   f.ContentLength,
+			Reason: "rename",
+			run: func(w *planWorker) error {
+				_, err := w.bucket(b).verifiedCopy(f, nil, newName, nil)
+				return err
+			},
+		})
+		requires := len(plan.Actions)
+
+		reason := "renamed to " + newName
+		if action == SourceHide {
+			plan.Actions = append(plan.Actions, b.hideAction(f, reason, requires))
+			continue
+		}
+		deletes, err := b.deleteVersionActions(f.Name, reason, requires)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, deletes...)
+	}
+	return plan, nil
+}
+
+// versionsWithPrefix lists every version of the files starting with prefix,
+// by name and then newest first.
+func (b *Bucket) versionsWithPrefix(prefix string) ([]FileMeta, error) {
+	versions := []FileMeta{}
+	nextName, nextID := prefix, ""
+	for {
+		lfr, err := b.ListFileVersions(nextName, nextID, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range lfr.Files {
+			if !strings.HasPrefix(f.Name, prefix) {
+				return versions, nil
+			}
+			versions = append(versions, f)
+		}
+		if lfr.NextFileName == "" {
+			return versions, nil
+		}
+		nextName, nextID = lfr.NextFileName, lfr.NextFileID
+	}
+}
@@ -0,0 +1,217 @@
+package b2
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan_Execute(t *testing.T) {
+	order := make(chan string, 3)
+	plan := &Plan{Concurrency: 1, Actions: []PlanAction{
+		{Op: PlanHide, Name: "a", run: func(*planWorker) error { order <- "hide a"; return nil }},
+		{Op: PlanCopy, Name: "b", run: func(*planWorker) error { return fmt.Errorf("copy failed") }},
+		{Op: PlanDeleteVersion, Name: "c", requires: 2, run: func(*planWorker) error { order <- "delete c"; return nil }},
+		{Op: PlanUpload, Name: "d", run: func(*planWorker) error { order <- "upload d"; return nil }},
+	}}
+
+	err := plan.Execute()
+	if err == nil || !strings.Contains(err.Error(), "copy failed") {
+		t.Fatalf("Expected the copy to fail, instead got %v", err)
+	}
+	close(order)
+	taken := []string{}
+	for o := range order {
+		taken = append(taken, o)
+	}
+	if strings.Join(taken, ", ") != "upload d, hide a" {
+		t.Errorf("Expected uploads before hides and no delete, instead got %v", taken)
+	}
+	if plan.Actions[2].Err == nil {
+		t.Error("Expected the delete to be skipped after its copy failed")
+	}
+	if failed := plan.Failed(); len(failed) != 2 {
+		t.Errorf("Expected 2 failed actions, instead got %+v", failed)
+	}
+	if err := plan.Execute(); err == nil {
+		t.Error("Expected a second Execute to fail")
+	}
+}
+
+func TestPlan_String(t *testing.T) {
+	plan := &Plan{Unchanged: 2, Actions: []PlanAction{
+		{Op: PlanUpload, Name: "a.txt", Source: "/tmp/a.txt", Size: 10, Reason: "new file"},
+		{Op: PlanDeleteVersion, Name: "b.txt", FileID: "b1", Size: 5, Reason: "not in source"},
+		{Op: PlanUpload, Name: "c.txt", Source: "/tmp/c.txt", Size: 1, Reason: "size differs"},
+	}}
+	expected := "upload          /tmp/a.txt -> a.txt  10  new file\n" +
+		"delete version  b.txt (b1)           5   not in source\n" +
+		"upload          /tmp/c.txt -> c.txt  1   size differs\n" +
+		"1 delete version (5 bytes), 2 upload (11 bytes); 2 unchanged\n"
+	if s := plan.String(); s != expected {
+		t.Errorf("Expected:\n%s\ninstead got:\n%s", expected, s)
+	}
+
+	plan.Executed = true
+	plan.Actions[1].Err = fmt.Errorf("gone")
+	if s := plan.String(); !strings.Contains(s, "FAILED: gone") || !strings.HasSuffix(s, "; 1 failed\n") {
+		t.Errorf("Expected the failure to be shown, instead got:\n%s", s)
+	}
+	if s := (&Plan{}).String(); s != "nothing to do; 0 unchanged\n" {
+		t.Errorf("Expected an empty plan, instead got %q", s)
+	}
+}
+
+func TestPlan_JSON(t *testing.T) {
+	plan := &Plan{Executed: true, Actions: []PlanAction{
+		{Op: PlanCopy, Name: "new", Source: "old", FileID: "f1", Size: 3, Reason: "rename", Err: fmt.Errorf("failed")},
+		{Op: PlanHide, Name: "old", Reason: "renamed to new"},
+	}}
+	data, err := plan.JSON()
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	out := struct {
+		Actions []map[string]interface{} `json:"actions"`
+	}{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Expected valid JSON, instead got %s", err)
+	}
+	if len(out.Actions) != 2 {
+		t.Fatalf("Expected 2 actions, instead got %s", data)
+	}
+	c := out.Actions[0]
+	if c["op"] != "copy" || c["source"] != "old" || c["fileId"] != "f1" || c["size"] != 3.0 || c["error"] != "failed" {
+		t.Errorf("Expected the copy action, instead got %v", c)
+	}
+	if _, ok := out.Actions[1]["error"]; ok {
+		t.Errorf("Expected no error on the hide action, instead got %v", out.Actions[1])
+	}
+}
+
+func TestBucket_PlanDeletePrefix(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "logs/a", []byte("a1"), nil)
+	fake.put("id", "logs/a", []byte("a2"), nil)
+	fake.add("id", "logs/b", ActionHide, nil, nil)
+	fake.put("id", "keep", []byte("keep"), nil)
+
+	plan, err := bucket.PlanDeletePrefix("logs/")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(plan.Actions) != 3 {
+		t.Fatalf("Expected 3 versions to delete, instead got %+v", plan.Actions)
+	}
+	for _, a := range plan.Actions {
+		if a.Op != PlanDeleteVersion || a.FileID == "" {
+			t.Errorf("Expected a version delete, instead got %+v", a)
+		}
+	}
+
+	// a version uploaded after planning isn't deleted
+	fake.put("id", "logs/c", []byte("c"), nil)
+	if err := plan.Execute(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	checkNames(t, fake.names("id"), []string{"keep", "logs/c"})
+}
+
+func TestBucket_PlanPruneVersions(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	for i := 0; i < 4; i++ {
+		fake.put("id", "a", []byte{byte(i)}, nil)
+	}
+	fake.put("id", "b", []byte("b"), nil)
+
+	if _, err := bucket.PlanPruneVersions("", 0); err == nil {
+		t.Error("Expected keeping 0 versions to fail")
+	}
+	plan, err := bucket.PlanPruneVersions("", 2)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(plan.Actions) != 2 || plan.Unchanged != 2 {
+		t.Fatalf("Expected 2 versions of a to be pruned, instead got %+v", plan)
+	}
+	if err := plan.Execute(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	fake.mu.Lock()
+	versions := fake.all("id")
+	fake.mu.Unlock()
+	if len(versions) != 3 {
+		t.Errorf("Expected 3 versions to remain, instead got %d", len(versions))
+	}
+	if data, _ := fake.data("id", "a"); len(data) != 1 || data[0] != 3 {
+		t.Errorf("Expected the newest version of a to remain, instead got %v", data)
+	}
+}
+
+func TestBucket_PlanRenamePrefix(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "old/a", []byte("a"), nil)
+	fake.put("id", "old/a", []byte("aa"), nil)
+	fake.put("id", "old/b", []byte("b"), nil)
+
+	plan, err := bucket.PlanRenamePrefix("old/", "new/", SourceDelete)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	ops := []string{}
+	for _, a := range plan.Actions {
+		ops = append(ops, string(a.Op)+" "+a.Name)
+	}
+	expected := "copy new/a, delete version old/a, delete version old/a, copy new/b, delete version old/b"
+	if strings.Join(ops, ", ") != expected {
+		t.Errorf("Expected %s, instead got %v", expected, ops)
+	}
+	if err := plan.Execute(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	checkNames(t, fake.names("id"), []string{"new/a", "new/b"})
+
+	for _, tc := range []struct {
+		old, new string
+		action   SourceAction
+	}{
+		{"", "new/", SourceHide},
+		{"new/", "new/", SourceHide},
+		{"new/", "x/", SourceAction(9)},
+		{"new/", "new/archive/", SourceHide},
+		{"new/archive/", "new/", SourceDelete},
+	} {
+		if _, err := bucket.PlanRenamePrefix(tc.old, tc.new, tc.action); err == nil {
+			t.Errorf("Expected renaming %q to %q with %d to fail", tc.old, tc.new, tc.action)
+		}
+	}
+	checkNames(t, fake.names("id"), []string{"new/a", "new/b"})
+
+	// a file without a sha1 fails planning, before anything is copied
+	fake.put("id", "new/c", []byte("c"), nil)
+	fake.versions[len(fake.versions)-1].meta.ContentSha1 = "none"
+	if _, err := bucket.PlanRenamePrefix("new/", "old/", SourceHide); err == nil {
+		t.Error("Expected renaming a file without a sha1 to fail")
+	}
+	checkNames(t, fake.names("id"), []string{"new/a", "new/b", "new/c"})
+}
+
+func TestBucket_SyncFromLocal_executePlan(t *testing.T) {
+	dir := t.TempDir()
+	testWriteFile(t, dir, "a.txt", "a", time.Now())
+	bucket, fake := testFakeBucket()
+	fake.put("id", "old.txt", []byte("old"), nil)
+
+	plan, err := bucket.SyncFromLocal(dir, "", &SyncOptions{Extraneous: DeleteExtraneous, DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	// files added after planning are left alone
+	testWriteFile(t, dir, "b.txt", "b", time.Now())
+	if err := plan.Execute(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	checkNames(t, fake.names("id"), []string{"a.txt"})
+}
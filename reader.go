@@ -0,0 +1,343 @@
+package b2
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// The default ReaderOptions.
+const (
+	DefaultBlockSize   = 1 << 20
+	DefaultReadAhead   = 4
+	DefaultCacheBlocks = 16
+)
+
+// ReaderOptions are the optional settings of a Reader.
+type ReaderOptions struct {
+	// BlockSize is the size of each ranged download. It defaults to
+	// DefaultBlockSize.
+	BlockSize int
+
+	// ReadAhead is the number of extra blocks downloaded along with a block
+	// that is read sequentially. It defaults to DefaultReadAhead, and may
+	// be negative to disable read-ahead. It is limited to CacheBlocks-1, so
+	// that the blocks read ahead fit in the cache.
+	ReadAhead int
+
+	// CacheBlocks is the number of most recently used blocks kept in
+	// memory. It defaults to DefaultCacheBlocks.
+	CacheBlocks int
+
+	// Encryption must hold the customer key to read a file that was
+	// uploaded with SSE-C.
+	Encryption *Encryption
+}
+
+// Reader is an io.ReadSeeker and io.ReaderAt over a file in B2, for random
+// access to files that are too large to download at once.
+//
+// The file is downloaded in blocks with ranged requests, and recently used
+// blocks are cached, so that small reads don't each cost a request. Reading
+// sequentially downloads several blocks ahead at a time.
+//
+// ReadAt may be called concurrently, but Read and Seek may not.
+type Reader struct {
+	bucket *Bucket
+	opts   ReaderOptions
+	meta   FileMeta
+	offset int64
+
+	mu     sync.Mutex
+	blocks map[int64][]byte
+	used   []int64 // cached blocks, least recently used first
+	next   int64   // the block after the last downloaded one
+}
+
+// Open returns a Reader over the current version of the named file. The
+// first block is downloaded to find the file's size and ID.
+func (b *Bucket) Open(name string, opts *ReaderOptions) (*Reader, error) {
+	return b.openReader(opts, func(dopts *DownloadOptions) (*File, error) {
+		return b.DownloadFileByNameWithOptions(name, dopts)
+	})
+}
+
+// OpenByID returns a Reader over a file version given its ID. The first
+// block is downloaded to find the file's size.
+func (b *Bucket) OpenByID(id string, opts *ReaderOptions) (*Reader, error) {
+	return b.openReader(opts, func(dopts *DownloadOptions) (*File, error) {
+		return b.DownloadFileByIDWithOptions(id, dopts)
+	})
+}
+
+func (b *Bucket) openReader(opts *ReaderOptions, download func(*DownloadOptions) (*File, error)) (*Reader, error) {
+	r := &Reader{bucket: b, blocks: map[int64][]byte{}}
+	if opts != nil {
+		r.opts = *opts
+	}
+	if r.opts.BlockSize <= 0 {
+		r.opts.BlockSize = DefaultBlockSize
+	}
+	if r.opts.ReadAhead == 0 {
+		r.opts.ReadAhead = DefaultReadAhead
+	}
+	if r.opts.ReadAhead < 0 {
+		r.opts.ReadAhead = 0
+	}
+	if r.opts.CacheBlocks <= 0 {
+		r.opts.CacheBlocks = DefaultCacheBlocks
+	}
+	if r.opts.ReadAhead > r.opts.CacheBlocks-1 {
+		r.opts.ReadAhead = r.opts.CacheBlocks - 1
+	}
+
+	span := r.span(0)
+	f, err := download(&DownloadOptions{Encryption: r.opts.Encryption, Range: &span})
+	if e, ok := err.(*APIError); ok && e.Status == 416 {
+		// an empty file has no range to download
+		f, err = download(&DownloadOptions{Encryption: r.opts.Encryption})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.meta = f.Meta
+	r.meta.ContentLength = f.Meta.Size
+	r.store(0, f.Data)
+	return r, nil
+}
+
+// Meta returns the FileMeta of the file being read.
+func (r *Reader) Meta() *FileMeta {
+	return &r.meta
+}
+
+// Size returns the size of the file.
+func (r *Reader) Size() int64 {
+	return r.meta.Size
+}
+
+// Read reads from the current offset.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read.
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.meta.Size
+	default:
+		return 0, fmt.Errorf("Invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Negative seek offset %d", offset)
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes at off, downloading any blocks that aren't
+// cached.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Negative read offset %d", off)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	bs := int64(r.opts.BlockSize)
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.meta.Size {
+			return n, io.EOF
+		}
+		block, err := r.block(pos / bs)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos%bs:])
+	}
+	return n, nil
+}
+
+// Close drops the cached blocks.
+func (r *Reader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocks = map[int64][]byte{}
+	r.used = nil
+	return nil
+}
+
+// block returns a block from the cache, downloading it and, if it's being
+// read sequentially, the blocks after it.
+func (r *Reader) block(i int64) ([]byte, error) {
+	if data, ok := r.blocks[i]; ok {
+		r.touch(i)
+		return data, nil
+	}
+
+	count := int64(1)
+	if i == r.next {
+		count += int64(r.opts.ReadAhead)
+	}
+	span := r.span(i)
+	last := r.span(i + count - 1)
+	span.End = last.End
+
+	f, err := r.bucket.DownloadFileByIDWithOptions(r.meta.ID, &DownloadOptions{
+		Encryption: r.opts.Encryption,
+		Range:      &span,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if f.Meta.ID != r.meta.ID || f.Meta.Size != r.meta.Size {
+		return nil, fmt.Errorf("File %s changed while being read", r.meta.Name)
+	}
+
+	if len(f.Data) == 0 {
+		return nil, fmt.Errorf("Block %d of %s wasn't downloaded", i, r.meta.Name)
+	}
+	// the requested block is kept here, as storing the blocks after it may
+	// evict it from the cache
+	var data []byte
+	bs := int64(r.opts.BlockSize)
+	for j := int64(0); j*bs < int64(len(f.Data)); j++ {
+		end := (j + 1) * bs
+		if end > int64(len(f.Data)) {
+			end = int64(len(f.Data))
+		}
+		if j == 0 {
+			data = f.Data[:end]
+		}
+		r.store(i+j, f.Data[j*bs:end])
+	}
+	return data, nil
+}
+
+// span is the byte range of block i, which may extend past the end of the
+// file.
+func (r *Reader) span(i int64) ByteRange {
+	bs := int64(r.opts.BlockSize)
+	return ByteRange{Start: i * bs, End: (i+1)*bs - 1}
+}
+
+// store caches a block, evicting the least recently used blocks.
+func (r *Reader) store(i int64, data []byte) {
+	r.blocks[i] = data
+	r.touch(i)
+	if i >= r.next {
+		r.next = i + 1
+	}
+	for len(r.used) > r.opts.CacheBlocks {
+		delete(r.blocks, r.used[0])
+		r.used = r.used[1:]
+	}
+}
+
+// touch marks a block as the most recently used.
+func (r *Reader) touch(i int64) {
+	for j, u := range r.used {
+		if u == i {
+			r.used = append(r.used[:j], r.used[j+1:]...)
+			break
+		}
+	}
+	r.used = append(r.used, i)
+}
+
+// streamReader is an io.ReadSeeker over a file in B2. Each read after a
+// seek starts a new download from the current offset to the end of the file,
+// which is streamed rather than read into memory. Unlike a Reader it doesn't
+// need to download anything to be opened, given the file's FileMeta.
+type streamReader struct {
+	bucket *Bucket
+	meta   *FileMeta
+	enc    *Encryption
+	offset int64
+	body   io.ReadCloser
+}
+
+func (sr *streamReader) Read(p []byte) (int, error) {
+	if sr.offset >= sr.meta.ContentLength {
+		return 0, io.EOF
+	}
+	if sr.body == nil {
+		if err := sr.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := sr.body.Read(p)
+	sr.offset += int64(n)
+	return n, err
+}
+
+func (sr *streamReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sr.offset
+	case io.SeekEnd:
+		offset += sr.meta.ContentLength
+	default:
+		return 0, fmt.Errorf("Invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Negative seek offset %d", offset)
+	}
+	if offset != sr.offset {
+		sr.Close()
+		sr.offset = offset
+	}
+	return offset, nil
+}
+
+func (sr *streamReader) Close() error {
+	if sr.body == nil {
+		return nil
+	}
+	err := sr.body.Close()
+	sr.body = nil
+	return err
+}
+
+// open downloads the file by ID from the current offset.
+func (sr *streamReader) open() error {
+	if err := sr.enc.validate(); err != nil {
+		return err
+	}
+	req, err := CreateRequest("GET", sr.bucket.B2.DownloadURL+"/b2api/v1/b2_download_file_by_id?fileId="+sr.meta.ID, nil)
+	if err != nil {
+		return err
+	}
+	sr.bucket.authorizeDownload(req, sr.enc)
+	if sr.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", sr.offset))
+	}
+	// a stored Content-Encoding is passed through, so net/http must not
+	// decompress the body itself
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := sr.bucket.B2.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 206 {
+		defer resp.Body.Close()
+		return parseAPIError(resp)
+	}
+	sr.body = resp.Body
+	return nil
+}
@@ -0,0 +1,180 @@
+package b2
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestBucket_Open(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	plain := testPlaintext(100)
+	fake.put("id", "name", plain, nil)
+
+	r, err := bucket.Open("name", &ReaderOptions{BlockSize: 10, ReadAhead: 2, CacheBlocks: 4})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if r.Size() != 100 || r.Meta().Name != "name" {
+		t.Errorf("Expected a 100 byte file named name, instead got %+v", r.Meta())
+	}
+
+	cases := []struct {
+		off      int64
+		size     int
+		requests int
+	}{
+		{off: 0, size: 5, requests: 0},   // the first block is downloaded by Open
+		{off: 5, size: 10, requests: 1},  // blocks 1 through 3 are read ahead
+		{off: 25, size: 20, requests: 1}, // block 3 is cached, 4 is read with 5 and 6
+		{off: 95, size: 5, requests: 1},  // a random read of block 9 alone
+		{off: 2, size: 3, requests: 1},   // block 0 has been evicted
+	}
+	for i, c := range cases {
+		before := len(fake.requests)
+		p := make([]byte, c.size)
+		n, err := r.ReadAt(p, c.off)
+		if err != nil || n != c.size {
+			t.Fatalf("Expected to read %d bytes, instead got %d with %v, case %d", c.size, n, err, i)
+		}
+		if !bytes.Equal(p, plain[c.off:c.off+int64(c.size)]) {
+			t.Errorf("Expected %q, instead got %q, case %d", plain[c.off:c.off+int64(c.size)], p, i)
+		}
+		if made := len(fake.requests) - before; made != c.requests {
+			t.Errorf("Expected %d requests, instead made %d, case %d", c.requests, made, i)
+		}
+	}
+
+	p := make([]byte, 10)
+	n, err := r.ReadAt(p, 95)
+	if n != 5 || err != io.EOF {
+		t.Errorf("Expected 5 bytes and EOF, instead got %d and %v", n, err)
+	}
+}
+
+func TestReader_ReadSeeker(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	plain := testPlaintext(45)
+	meta := fake.put("id", "name", plain, nil)
+
+	r, err := bucket.OpenByID(meta.ID, &ReaderOptions{BlockSize: 8})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(data, plain) {
+		t.Errorf("Expected %q, instead got %q with %v", plain, data, err)
+	}
+
+	if pos, err := r.Seek(-5, io.SeekEnd); err != nil || pos != 40 {
+		t.Errorf("Expected to seek to 40, instead got %d with %v", pos, err)
+	}
+	data, _ = ioutil.ReadAll(r)
+	if !bytes.Equal(data, plain[40:]) {
+		t.Errorf("Expected %q, instead got %q", plain[40:], data)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected a negative seek to fail")
+	}
+}
+
+func TestReader_smallCache(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	plain := testPlaintext(100)
+	meta := fake.put("id", "name", plain, nil)
+
+	for _, cache := range []int{1, 2} {
+		// the default ReadAhead is more than the cache can hold
+		r, err := bucket.OpenByID(meta.ID, &ReaderOptions{BlockSize: 10, CacheBlocks: cache})
+		if err != nil {
+			t.Fatalf("Expected no error, instead got %s", err)
+		}
+		if r.opts.ReadAhead != cache-1 {
+			t.Errorf("Expected ReadAhead to be limited to %d, instead got %d", cache-1, r.opts.ReadAhead)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(data, plain) {
+			t.Errorf("Expected %q, instead got %q with %v, cache %d", plain, data, err, cache)
+		}
+	}
+
+	// the requested block is returned even if the blocks read ahead evict
+	// it from the cache
+	r, _ := bucket.OpenByID(meta.ID, &ReaderOptions{BlockSize: 10, CacheBlocks: 2})
+	r.opts.ReadAhead = 4
+	data, err := r.block(1)
+	if err != nil || !bytes.Equal(data, plain[10:20]) {
+		t.Errorf("Expected %q, instead got %q with %v", plain[10:20], data, err)
+	}
+}
+
+func TestReader_zip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		w, _ := zw.Create(name)
+		w.Write(bytes.Repeat([]byte(name), 50))
+	}
+	zw.Close()
+
+	bucket, fake := testFakeBucket()
+	fake.put("id", "archive.zip", buf.Bytes(), nil)
+	r, err := bucket.Open("archive.zip", &ReaderOptions{BlockSize: 64})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	zr, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	f, err := zr.Open("b.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	data, _ := ioutil.ReadAll(f)
+	if !bytes.Equal(data, bytes.Repeat([]byte("b.txt"), 50)) {
+		t.Errorf("Expected b.txt's contents, instead got %q", data)
+	}
+}
+
+func TestBucket_Open_empty(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "empty", nil, nil)
+	r, err := bucket.Open("empty", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || len(data) != 0 {
+		t.Errorf("Expected no data, instead got %q with %v", data, err)
+	}
+
+	if _, err := bucket.Open("missing", nil); err == nil {
+		t.Error("Expected opening a missing file to fail")
+	}
+}
+
+func TestStreamReader_Seek(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	plain := testPlaintext(20)
+	meta := fake.put("id", "name", plain, nil)
+	meta.ContentLength = 20
+	sr := &streamReader{bucket: bucket, meta: &meta}
+	defer sr.Close()
+
+	if pos, err := sr.Seek(-5, io.SeekEnd); err != nil || pos != 15 {
+		t.Errorf("Expected to seek to 15, instead got %d with %v", pos, err)
+	}
+	if pos, err := sr.Seek(2, io.SeekCurrent); err != nil || pos != 17 {
+		t.Errorf("Expected to seek to 17, instead got %d with %v", pos, err)
+	}
+	data, err := ioutil.ReadAll(sr)
+	if err != nil || !bytes.Equal(data, plain[17:]) {
+		t.Errorf("Expected %q, instead got %q with %v", plain[17:], data, err)
+	}
+	if _, err := sr.Seek(0, 7); err == nil {
+		t.Error("Expected an invalid whence to fail")
+	}
+}
@@ -0,0 +1,96 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// StatFileByName gets the FileMeta of the current version of a named file
+// without downloading it, by making a HEAD request to the download by name
+// endpoint. The FileMeta is read from the response headers, and its Size is
+// the size of the whole file.
+//
+// enc is needed to stat a file encrypted with SSE-C, and may be nil
+// otherwise. If the Bucket is private, Authorization will be set
+// automatically.
+func (b *Bucket) StatFileByName(name string, enc *Encryption) (*FileMeta, error) {
+	if err := ValidateFileName(name); err != nil {
+		return nil, err
+	}
+	return b.statFile(b.fileURL(name), enc)
+}
+
+// StatFileByID gets the FileMeta of a file version given its ID, without
+// downloading it, by making a HEAD request to the download by ID endpoint.
+//
+// Unlike GetFileInfo, the FileMeta is read from the download headers, so it
+// is only available for uploaded files.
+func (b *Bucket) StatFileByID(id string, enc *Encryption) (*FileMeta, error) {
+	return b.statFile(b.B2.DownloadURL+"/b2api/v1/b2_download_file_by_id?fileId="+id, enc)
+}
+
+func (b *Bucket) statFile(url string, enc *Encryption) (*FileMeta, error) {
+	if err := enc.validate(); err != nil {
+		return nil, err
+	}
+	req, err := CreateRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	b.authorizeDownload(req, enc)
+
+	resp, err := b.B2.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return b.parseStat(resp)
+}
+
+// parseStat turns a HEAD response into a *FileMeta.
+func (b *Bucket) parseStat(resp *http.Response) (*FileMeta, error) {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, parseHeadError(resp)
+	}
+
+	size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	meta := metaFromHeaders(resp.Header)
+	meta.Size = size
+	meta.ContentLength = size
+	meta.Bucket = b
+	return &meta, nil
+}
+
+// parseHeadError returns the error of a HEAD response. B2 doesn't send a
+// body with the error of a HEAD request, so if there is none an APIError is
+// made from the status.
+func parseHeadError(resp *http.Response) error {
+	bts, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bts) > 0 {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(bts))
+		return parseAPIError(resp)
+	}
+	return &APIError{
+		Status:  int64(resp.StatusCode),
+		Code:    headErrorCodes[resp.StatusCode],
+		Message: http.StatusText(resp.StatusCode),
+	}
+}
+
+// headErrorCodes are the codes B2 would have given the error of a HEAD
+// request, had it sent a body.
+var headErrorCodes = map[int]string{
+	400: "bad_request",
+	401: "unauthorized",
+	403: "access_denied",
+	404: "not_found",
+}
@@ -0,0 +1,111 @@
+package b2
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBucket_StatFileByName(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	fake.put("id", "old.txt", []byte("old"), nil)
+	meta := fake.put("id", "dir/cat pics.txt", []byte("cats"), map[string]string{"owner": "ünïcödé"})
+
+	stat, err := bucket.StatFileByName("dir/cat pics.txt", nil)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if stat.ID != meta.ID || stat.Name != meta.Name || stat.Size != 4 || stat.ContentLength != 4 ||
+		stat.ContentSha1 != meta.ContentSha1 || stat.FileInfo["owner"] != "ünïcödé" ||
+		stat.UploadTimestamp != meta.UploadTimestamp || stat.Action != ActionUpload || stat.Bucket != bucket {
+		t.Errorf("Expected %+v, instead got %+v", meta, stat)
+	}
+	if req := fake.requests[len(fake.requests)-1]; req.Method != "HEAD" {
+		t.Errorf("Expected a HEAD request, instead got %s", req.Method)
+	}
+
+	byID, err := bucket.StatFileByID(meta.ID, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if byID.Name != meta.Name || byID.Size != 4 {
+		t.Errorf("Expected %+v, instead got %+v", meta, byID)
+	}
+}
+
+func TestBucket_StatFileByName_notFound(t *testing.T) {
+	bucket, _ := testFakeBucket()
+	_, err := bucket.StatFileByName("missing.txt", nil)
+	if e, ok := err.(*APIError); !ok || e.Status != 404 {
+		t.Errorf("Expected a 404 APIError, instead got %v", err)
+	}
+	_, err = bucket.StatFileByID("missing", nil)
+	if e, ok := err.(*APIError); !ok || e.Status != 404 {
+		t.Errorf("Expected a 404 APIError, instead got %v", err)
+	}
+	if _, err := bucket.StatFileByName("bad//name", nil); err == nil {
+		t.Error("Expected an invalid name to fail")
+	}
+}
+
+func TestBucket_StatFileByName_request(t *testing.T) {
+	bucket := testBucket()
+	bucket.Type = AllPrivate
+	ssec, _ := SSEC(testSSECKey())
+	bucket.StatFileByName("cat pics.jpg", ssec)
+
+	req := bucket.B2.client.(*testClient).Request
+	if req.Method != "HEAD" || req.URL.String() != "https://f900.backblaze.com/file/bucket/cat%20pics.jpg" {
+		t.Errorf("Expected a HEAD of the file URL, instead got %s %s", req.Method, req.URL)
+	}
+	if req.Header.Get("Authorization") == "" {
+		t.Error("Expected Authorization to be set")
+	}
+	if req.Header.Get("X-Bz-Server-Side-Encryption-Customer-Key") != ssec.CustomerKey {
+		t.Errorf("Expected the customer key to be set, instead got %v", req.Header)
+	}
+}
+
+func TestBucket_parseStat(t *testing.T) {
+	bucket := testBucket()
+	resp := testResponse(200, "")
+	resp.Header = http.Header{}
+	resp.Header.Set("Content-Length", "5000000000")
+	resp.Header.Set("X-Bz-File-Id", "fid")
+	resp.Header.Set("X-Bz-File-Name", "big%20file")
+	resp.Header.Set("X-Bz-Content-Sha1", "none")
+	resp.Header.Set("X-Bz-Upload-Timestamp", "1500000000000")
+	resp.Header.Set("X-Bz-Server-Side-Encryption", "AES256")
+	resp.Header.Set("X-Bz-File-Retention-Mode", "governance")
+	resp.Header.Set("X-Bz-File-Retention-Retain-Until-Timestamp", "1600000000000")
+	resp.Header.Set("X-Bz-File-Legal-Hold", "on")
+
+	meta, err := bucket.parseStat(resp)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if meta.ID != "fid" || meta.Name != "big file" || meta.Size != 5000000000 || meta.UploadTimestamp != 1500000000000 {
+		t.Errorf("Expected the file meta to be parsed, instead got %+v", meta)
+	}
+	if meta.Encryption == nil || meta.Encryption.Mode != EncryptionSSEB2 {
+		t.Errorf("Expected SSE-B2 encryption, instead got %+v", meta.Encryption)
+	}
+	if meta.Retention == nil || meta.Retention.Value.RetainUntilTimestamp != 1600000000000 {
+		t.Errorf("Expected a retention, instead got %+v", meta.Retention)
+	}
+	if meta.LegalHold == nil || meta.LegalHold.Value != LegalHoldOn {
+		t.Errorf("Expected a legal hold, instead got %+v", meta.LegalHold)
+	}
+}
+
+func TestParseHeadError(t *testing.T) {
+	err := parseHeadError(testResponse(404, ""))
+	if e, ok := err.(*APIError); !ok || e.Status != 404 || e.Code != "not_found" {
+		t.Errorf("Expected a not_found APIError, instead got %v", err)
+	}
+	for _, resp := range testAPIErrors() {
+		err := parseHeadError(resp)
+		if e, ok := err.(*APIError); !ok || e.Code != "nope" {
+			t.Errorf("Expected an APIError from the body, instead got %v", err)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package b2
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultSyncConcurrency is the number of files a sync or Plan transfers at
+// once.
+const DefaultSyncConcurrency = 4
+
+// Extraneous is what a sync does with files in the destination that aren't
+// in the source.
+type Extraneous string
+
+// Extraneous files may be kept, hidden or deleted. Deleting removes every
+// version of a file. Local files can't be hidden.
+const (
+	KeepExtraneous   Extraneous = ""
+	HideExtraneous   Extraneous = "hide"
+	DeleteExtraneous Extraneous = "delete"
+)
+
+// SyncOptions are the optional settings of a sync.
+type SyncOptions struct {
+	// CompareSHA1 compares files of the same size by sha1 rather than by
+	// modified time. Local files are read to find their sha1.
+	CompareSHA1 bool
+
+	// Extraneous is what to do with files that are only in the destination.
+	Extraneous Extraneous
+
+	// Include and Exclude are path.Match patterns, matched against each
+	// file's path relative to the synced directory or prefix, and against
+	// its base name. If Include is set, only matching files are synced.
+	// Excluded files are never synced, hidden or deleted.
+	Include []string
+	Exclude []string
+
+	// Concurrency is the number of files transferred at once. It defaults
+	// to DefaultSyncConcurrency.
+	Concurrency int
+
+	// DryRun returns the Plan of a sync without executing it.
+	DryRun bool
+
+	// Upload is the options of each upload. Compression isn't supported.
+	Upload *UploadOptions
+
+	// Encryption must hold the customer key to download or copy files that
+	// were uploaded with SSE-C.
+	Encryption *Encryption
+}
+
+// SyncFromLocal makes the files starting with prefix match the files in the
+// local directory dir. A local file "a/b.txt" is uploaded as prefix+"a/b.txt",
+// so prefix usually ends in "/".
+//
+// Files are uploaded if they're new, or if their size, or their sha1 or
+// modified time, differ. The local modified time is stored as
+// src_last_modified_millis.
+//
+// The executed Plan is returned, and if any action failed the first error is
+// returned along with it. With DryRun the Plan is returned unexecuted.
+func (b *Bucket) SyncFromLocal(dir, prefix string, opts *SyncOptions) (*Plan, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	local, err := localFiles(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := b.remoteFiles(prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Concurrency: opts.Concurrency}
+	for rel, lf := range local {
+		lf, name := lf, prefix+rel
+		a := PlanAction{Op: PlanUpload, Name: name, Source: lf.path, Size: lf.size}
+		rf, ok := remote[rel]
+		if !ok {
+			a.Reason = "new file"
+		} else if a.Reason, err = lf.differs(rf, opts); err != nil {
+			return nil, err
+		}
+		if a.Reason == "" {
+			plan.Unchanged++
+			continue
+		}
+		a.run = func(w *planWorker) error {
+			_, err := w.bucket(b).UploadLocalFile(lf.path, name, opts.Upload)
+			return err
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	for name, rf := range remote {
+		if _, ok := local[name]; ok {
+			continue
+		}
+		actions, err := b.extraneousActions(rf, opts)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, actions...)
+	}
+	plan.sort()
+	return plan, plan.execute(opts)
+}
+
+// SyncToLocal makes the local directory dir match the files starting with
+// prefix. A file named prefix+"a/b.txt" is downloaded to "a/b.txt" within
+// dir, which is created if needed. Files whose names aren't valid relative
+// paths, such as those containing "..", are skipped.
+//
+// Files are downloaded if they're new, or if their size, or their sha1 or
+// modified time, differ. The remote modified time is the file's
+// src_last_modified_millis, or its upload time if it has none, and is set as
+// the modified time of the downloaded file.
+//
+// Downloads are written to a temporary file and checked against their sha1,
+// when it is known, before replacing the local file.
+//
+// The executed Plan is returned, and if any action failed the first error is
+// returned along with it. With DryRun the Plan is returned unexecuted.
+func (b *Bucket) SyncToLocal(prefix, dir string, opts *SyncOptions) (*Plan, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.Extraneous == HideExtraneous {
+		return nil, fmt.Errorf("Local files can't be hidden")
+	}
+	if err := opts.Encryption.validate(); err != nil {
+		return nil, err
+	}
+
+	// a missing directory is synced as an empty one, and only created when
+	// the plan is executed
+	local := map[string]localFile{}
+	_, err := os.Stat(dir)
+	if err == nil {
+		local, err = localFiles(dir, opts)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	remote, err := b.remoteFiles(prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Concurrency: opts.Concurrency}
+	for name, rf := range remote {
+		if !fs.ValidPath(name) {
+			continue
+		}
+		rf, localPath := rf, filepath.Join(dir, filepath.FromSlash(name))
+		a := PlanAction{
+			Op:     PlanDownload,
+			Name:   localPath,
+			Source: rf.Name,
+			FileID: rf.ID,
+			Size:   rf.ContentLength,
+		}
+		lf, ok := local[name]
+		if !ok {
+			a.Reason = "new file"
+		} else if a.Reason, err = lf.differs(rf, opts); err != nil {
+			return nil, err
+		}
+		if a.Reason == "" {
+			plan.Unchanged++
+			continue
+		}
+		a.run = func(w *planWorker) error {
+			return b.downloadLocal(rf, localPath, opts.Encryption, true)
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	for name, lf := range local {
+		if _, ok := remote[name]; ok || opts.Extraneous == KeepExtraneous {
+			continue
+		}
+		localPath := lf.path
+		plan.Actions = append(plan.Actions, PlanAction{
+			Op:     PlanDeleteLocal,
+			Name:   localPath,
+			Size:   lf.size,
+			Reason: "not in source",
+			run: func(w *planWorker) error {
+				return os.Remove(localPath)
+			},
+		})
+	}
+	plan.sort()
+	if !opts.DryRun {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return plan, plan.execute(opts)
+}
+
+// SyncToBucket makes the files in dest starting with destPrefix match the
+// files in this bucket starting with prefix. A file named prefix+"a/b.txt"
+// is copied to destPrefix+"a/b.txt".
+//
+// Files are copied if they're new, or if their size, or their sha1 or
+// modified time, differ. Sha1s are always compared when both are known.
+//
+// When both buckets are under the same account, files are copied
+// server-side, keeping their file info and content type. Otherwise, or if a
+// file is too large for a server-side copy, it is streamed from this bucket
+// and uploaded to dest with the same file info. The Upload options apply to
+// streamed uploads, and their Encryption to server-side copies.
+//
+// The executed Plan is returned, and if any action failed the first error is
+// returned along with it. With DryRun the Plan is returned unexecuted.
+func (b *Bucket) SyncToBucket(prefix string, dest *Bucket, destPrefix string, opts *SyncOptions) (*Plan, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	if dest == nil {
+		return nil, fmt.Errorf("No destination bucket provided")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Encryption.validate(); err != nil {
+		return nil, err
+	}
+	if dest.ID == b.ID && overlaps(prefix, destPrefix) {
+		return nil, fmt.Errorf("Prefixes %q and %q overlap", prefix, destPrefix)
+	}
+
+	src, err := b.remoteFiles(prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := dest.remoteFiles(destPrefix, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sameAccount := b.B2.AccountID == dest.B2.AccountID
+	plan := &Plan{Concurrency: opts.Concurrency}
+	for name, sf := range src {
+		sf, destName := sf, destPrefix+name
+		a := PlanAction{Op: PlanCopy, Name: destName, Source: sf.Name, FileID: sf.ID, Size: sf.ContentLength}
+		if df, ok := dst[name]; !ok {
+			a.Reason = "new file"
+		} else {
+			a.Reason = remoteDiffers(sf, df)
+		}
+		if a.Reason == "" {
+			plan.Unchanged++
+			continue
+		}
+		a.run = func(w *planWorker) error {
+			if sameAccount && sf.ContentLength <= maxCopySize {
+				copts := &CopyOptions{SourceEncryption: opts.Encryption}
+				if opts.Upload != nil {
+					copts.DestinationEncryption = opts.Upload.Encryption
+				}
+				_, err := b.CopyFileWithOptions(sf.ID, destName, dest, copts)
+				return err
+			}
+			return w.bucket(dest).streamCopy(b, sf, destName, opts)
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	for name, df := range dst {
+		if _, ok := src[name]; ok {
+			continue
+		}
+		actions, err := dest.extraneousActions(df, opts)
+		if err != nil {
+			return nil, err
+		}
+		plan.Actions = append(plan.Actions, actions...)
+	}
+	plan.sort()
+	return plan, plan.execute(opts)
+}
+
+// extraneousActions plans hiding, or deleting every version of, a file that
+// isn't in the source of a sync.
+func (b *Bucket) extraneousActions(f FileMeta, opts *SyncOptions) ([]PlanAction, error) {
+	switch opts.Extraneous {
+	case HideExtraneous:
+		return []PlanAction{b.hideAction(f, "not in source", 0)}, nil
+	case DeleteExtraneous:
+		return b.deleteVersionActions(f.Name, "not in source", 0)
+	}
+	return nil, nil
+}
+
+// sort sorts a sync's actions by name. Sync actions never require others,
+// so they can be reordered.
+func (p *Plan) sort() {
+	sort.SliceStable(p.Actions, func(i, j int) bool { return p.Actions[i].Name < p.Actions[j].Name })
+}
+
+// execute executes a sync's Plan, unless it's a dry run.
+func (p *Plan) execute(opts *SyncOptions) error {
+	if opts.DryRun {
+		return nil
+	}
+	return p.Execute()
+}
+
+// streamCopy downloads a file from src and uploads it to this bucket as
+// name, with the same file info and content type.
+func (b *Bucket) streamCopy(src *Bucket, meta FileMeta, name string, opts *SyncOptions) error {
+	uopts := UploadOptions{}
+	if opts.Upload != nil {
+		uopts = *opts.Upload
+	}
+	fileInfo := map[string]string{}
+	for k, v := range meta.FileInfo {
+		fileInfo[k] = v
+	}
+	for k, v := range uopts.FileInfo {
+		fileInfo[k] = v
+	}
+	uopts.FileInfo = fileInfo
+	if uopts.ContentType == "" {
+		uopts.ContentType = meta.ContentType
+	}
+
+	r := &streamReader{bucket: src, meta: &meta, enc: opts.Encryption}
+	defer r.Close()
+	w := b.NewWriter(name, &uopts)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// like a server-side copy, a streamed copy is checked against its
+	// source, and removed if it doesn't match
+	fm := w.Meta()
+	if want := fileSha1(&meta); want != "" && fileSha1(fm) != want {
+		b.DeleteFileVersion(fm.Name, fm.ID)
+		return fmt.Errorf("Copy sha1 %s didn't match source sha1 %s", fileSha1(fm), want)
+	}
+	return nil
+}
+
+// remoteDiffers returns why a file needs to be copied over another, or ""
+// if they're the same.
+func remoteDiffers(src, dst FileMeta) string {
+	if src.ContentLength != dst.ContentLength {
+		return "size differs"
+	}
+	if s, d := fileSha1(&src), fileSha1(&dst); s != "" && d != "" {
+		if s != d {
+			return "sha1 differs"
+		}
+		return ""
+	}
+	// a copy keeps the file info of its source, so large files without a
+	// sha1 are compared by their src_last_modified_millis
+	sm, sok := srcLastModified(&src)
+	dm, dok := srcLastModified(&dst)
+	if sok && dok {
+		if sm != dm {
+			return "modified time differs"
+		}
+		return ""
+	}
+	// a copy gets its own upload time, so otherwise only a destination
+	// uploaded before the source is out of date
+	if dst.UploadTimestamp < src.UploadTimestamp {
+		return "source is newer"
+	}
+	return ""
+}
+
+// validate checks the extraneous setting and patterns of a sync.
+func (opts *SyncOptions) validate() error {
+	switch opts.Extraneous {
+	case KeepExtraneous, HideExtraneous, DeleteExtraneous:
+	default:
+		return fmt.Errorf("Unknown extraneous setting %q", opts.Extraneous)
+	}
+	for _, p := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("Invalid pattern %q", p)
+		}
+	}
+	if opts.Upload != nil && opts.Upload.Compression != nil {
+		return fmt.Errorf("Compression isn't supported by sync")
+	}
+	return nil
+}
+
+// matches reports whether a relative path is included in a sync.
+func (opts *SyncOptions) matches(name string) bool {
+	match := func(patterns []string) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+			if ok, _ := path.Match(p, path.Base(name)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(opts.Include) > 0 && !match(opts.Include) {
+		return false
+	}
+	return !match(opts.Exclude)
+}
+
+// localFile is a regular file found in a synced directory.
+type localFile struct {
+	path   string
+	size   int64
+	millis int64
+}
+
+// localFiles finds the regular files in dir, by their slash separated path
+// relative to dir. Symlinks and other special files are skipped.
+func localFiles(dir string, opts *SyncOptions) (map[string]localFile, error) {
+	files := map[string]localFile{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !opts.matches(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = localFile{path: p, size: info.Size(), millis: info.ModTime().UnixNano() / 1e6}
+		return nil
+	})
+	return files, err
+}
+
+// differs returns why a local file needs to be synced with a remote file,
+// or "" if they're the same.
+func (lf localFile) differs(rf FileMeta, opts *SyncOptions) (string, error) {
+	if lf.size != rf.ContentLength {
+		return "size differs", nil
+	}
+	if sum := fileSha1(&rf); opts.CompareSHA1 && sum != "" {
+		local, err := localSha1(lf.path)
+		if err != nil {
+			return "", err
+		}
+		if local != sum {
+			return "sha1 differs", nil
+		}
+		return "", nil
+	}
+	if remoteModTime(&rf) != lf.millis {
+		return "modified time differs", nil
+	}
+	return "", nil
+}
+
+// remoteModTime is the modified time of a file in milliseconds, which is its
+// src_last_modified_millis, or its upload time if it has none.
+func remoteModTime(meta *FileMeta) int64 {
+	if millis, ok := srcLastModified(meta); ok {
+		return millis
+	}
+	return meta.UploadTimestamp
+}
+
+// remoteFiles lists the current files starting with prefix, by their name
+// after the prefix.
+func (b *Bucket) remoteFiles(prefix string, opts *SyncOptions) (map[string]FileMeta, error) {
+	files, err := b.listPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]FileMeta{}
+	for _, f := range files {
+		rel := strings.TrimPrefix(f.Name, prefix)
+		if f.Action != ActionUpload || !opts.matches(rel) {
+			continue
+		}
+		out[rel] = f
+	}
+	return out, nil
+}
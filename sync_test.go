@@ -0,0 +1,396 @@
+package b2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucket_SyncFromLocal(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Unix(1500000000, 0)
+	testWriteFile(t, dir, "a.txt", "same", modTime)
+	testWriteFile(t, dir, "sub/b.txt", "new", modTime)
+	testWriteFile(t, dir, "changed.txt", "new data", modTime)
+	testWriteFile(t, dir, "debug.log", "skipped", modTime)
+
+	bucket, fake := testFakeBucket()
+	millis := strconv.FormatInt(modTime.UnixNano()/1e6, 10)
+	fake.put("id", "backup/a.txt", []byte("same"), map[string]string{"src_last_modified_millis": millis})
+	fake.put("id", "backup/changed.txt", []byte("old data"), map[string]string{"src_last_modified_millis": "1"})
+	fake.put("id", "backup/old.txt", []byte("old"), nil)
+	fake.put("id", "backup/remote.log", []byte("excluded"), nil)
+	fake.put("id", "other/file", []byte("outside the prefix"), nil)
+
+	opts := &SyncOptions{Exclude: []string{"*.log"}, Extraneous: HideExtraneous, DryRun: true}
+	report, err := bucket.SyncFromLocal(dir, "backup/", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	expected := []PlanAction{
+		{Op: PlanUpload, Name: "backup/changed.txt", Size: 8, Reason: "modified time differs"},
+		{Op: PlanHide, Name: "backup/old.txt", Size: 3, Reason: "not in source"},
+		{Op: PlanUpload, Name: "backup/sub/b.txt", Size: 3, Reason: "new file"},
+	}
+	testCheckSyncActions(t, report, expected)
+	if report.Unchanged != 1 || report.Executed {
+		t.Errorf("Expected 1 unchanged file in a dry run, instead got %+v", report)
+	}
+	if names := fake.names("id"); len(names) != 5 {
+		t.Errorf("Expected a dry run to change nothing, instead got %v", names)
+	}
+
+	opts.DryRun = false
+	report, err = bucket.SyncFromLocal(dir, "backup/", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	testCheckSyncActions(t, report, expected)
+	checkNames(t, fake.names("id"), []string{"backup/a.txt", "backup/changed.txt", "backup/remote.log", "backup/sub/b.txt", "other/file"})
+	if data, _ := fake.data("id", "backup/changed.txt"); string(data) != "new data" {
+		t.Errorf("Expected changed.txt to be uploaded, instead got %q", data)
+	}
+	fm, _ := bucket.currentFile("backup/sub/b.txt")
+	if fm.FileInfo["src_last_modified_millis"] != millis {
+		t.Errorf("Expected src_last_modified_millis to be %s, instead got %+v", millis, fm.FileInfo)
+	}
+
+	// a second sync has nothing to do
+	report, err = bucket.SyncFromLocal(dir, "backup/", opts)
+	if err != nil || len(report.Actions) != 0 || report.Unchanged != 3 {
+		t.Errorf("Expected nothing to sync, instead got %+v with %v", report, err)
+	}
+}
+
+func TestBucket_SyncFromLocal_sha1(t *testing.T) {
+	dir := t.TempDir()
+	testWriteFile(t, dir, "same.txt", "same", time.Now())
+	testWriteFile(t, dir, "diff.txt", "abcd", time.Now())
+	bucket, fake := testFakeBucket()
+	fake.put("id", "same.txt", []byte("same"), nil)
+	fake.put("id", "diff.txt", []byte("dcba"), nil)
+	fake.put("id", "extra.txt", []byte("extra"), nil)
+
+	report, err := bucket.SyncFromLocal(dir, "", &SyncOptions{CompareSHA1: true, Extraneous: DeleteExtraneous, Concurrency: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	testCheckSyncActions(t, report, []PlanAction{
+		{Op: PlanUpload, Name: "diff.txt", Size: 4, Reason: "sha1 differs"},
+		{Op: PlanDeleteVersion, Name: "extra.txt", Size: 5, Reason: "not in source"},
+	})
+	fake.mu.Lock()
+	versions := len(fake.all("id"))
+	fake.mu.Unlock()
+	if versions != 3 {
+		t.Errorf("Expected every version of extra.txt to be deleted, instead got %d versions", versions)
+	}
+}
+
+func TestBucket_SyncFromLocal_errors(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	cases := []*SyncOptions{
+		{Extraneous: "shred"},
+		{Include: []string{"[bad"}},
+		{Upload: &UploadOptions{Compression: Gzip}},
+	}
+	for i, opts := range cases {
+		if _, err := bucket.SyncFromLocal(t.TempDir(), "", opts); err == nil {
+			t.Errorf("Expected invalid options to fail, case %d", i)
+		}
+	}
+	if _, err := bucket.SyncFromLocal(filepath.Join(t.TempDir(), "missing"), "", nil); err == nil {
+		t.Error("Expected a missing directory to fail")
+	}
+
+	dir := t.TempDir()
+	testWriteFile(t, dir, "a.txt", "a", time.Now())
+	report, err := bucket.SyncFromLocal(dir, "", &SyncOptions{Upload: &UploadOptions{LegalHold: "maybe"}})
+	if err == nil || len(report.Failed()) != 1 {
+		t.Errorf("Expected the upload to fail, instead got %+v with %v", report, err)
+	}
+	if names := fake.names("id"); len(names) != 0 {
+		t.Errorf("Expected nothing to be uploaded, instead got %v", names)
+	}
+}
+
+func TestBucket_SyncToLocal(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Unix(1500000000, 0)
+	millis := strconv.FormatInt(modTime.UnixNano()/1e6, 10)
+	testWriteFile(t, dir, "same.txt", "same", modTime)
+	testWriteFile(t, dir, "changed.txt", "old", modTime)
+	testWriteFile(t, dir, "local.txt", "only here", modTime)
+
+	bucket, fake := testFakeBucket()
+	fake.put("id", "backup/same.txt", []byte("same"), map[string]string{"src_last_modified_millis": millis})
+	fake.put("id", "backup/changed.txt", []byte("new!"), map[string]string{"src_last_modified_millis": millis})
+	fake.put("id", "backup/dir/new.txt", []byte("new"), map[string]string{"src_last_modified_millis": "1400000000000"})
+	fake.put("id", "backup/../escape.txt", []byte("outside"), nil)
+
+	report, err := bucket.SyncToLocal("backup/", dir, &SyncOptions{Extraneous: DeleteExtraneous})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	testCheckSyncActions(t, report, []PlanAction{
+		{Op: PlanDownload, Name: filepath.Join(dir, "changed.txt"), Size: 4, Reason: "size differs"},
+		{Op: PlanDownload, Name: filepath.Join(dir, "dir", "new.txt"), Size: 3, Reason: "new file"},
+		{Op: PlanDeleteLocal, Name: filepath.Join(dir, "local.txt"), Size: 9, Reason: "not in source"},
+	})
+	if report.Unchanged != 1 {
+		t.Errorf("Expected 1 unchanged file, instead got %d", report.Unchanged)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dir", "new.txt"))
+	if err != nil || string(data) != "new" {
+		t.Errorf("Expected dir/new.txt to be downloaded, instead got %q with %v", data, err)
+	}
+	info, _ := os.Stat(filepath.Join(dir, "dir", "new.txt"))
+	if !info.ModTime().Equal(time.Unix(1400000000, 0)) {
+		t.Errorf("Expected the mod time to be restored, instead got %s", info.ModTime())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "local.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected local.txt to be deleted, instead got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected escape.txt not to be written outside the directory, instead got %v", err)
+	}
+
+	report, err = bucket.SyncToLocal("backup/", dir, &SyncOptions{CompareSHA1: true})
+	if err != nil || len(report.Actions) != 0 {
+		t.Errorf("Expected nothing to sync, instead got %+v with %v", report, err)
+	}
+	if _, err := bucket.SyncToLocal("backup/", dir, &SyncOptions{Extraneous: HideExtraneous}); err == nil {
+		t.Error("Expected hiding local files to fail")
+	}
+}
+
+func TestBucket_SyncToLocal_missingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "restore")
+	bucket, fake := testFakeBucket()
+	fake.put("id", "backup/a.txt", []byte("a"), nil)
+
+	report, err := bucket.SyncToLocal("backup/", dir, &SyncOptions{DryRun: true})
+	if err != nil || len(report.Actions) != 1 {
+		t.Fatalf("Expected one planned download, instead got %+v with %v", report, err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected a dry run not to create %s, instead got %v", dir, err)
+	}
+
+	// the directory is created even when there is nothing to download
+	if _, err := bucket.SyncToLocal("empty/", dir, nil); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Expected the directory to be created, instead got %v", err)
+	}
+}
+
+func TestBucket_SyncToBucket(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	dest := testBucket()
+	dest.ID = "dr"
+	dest.B2.client = fake
+
+	fake.put("id", "src/same.txt", []byte("same"), nil)
+	fake.put("id", "src/changed.txt", []byte("abcd"), nil)
+	fake.put("id", "src/new.txt", []byte("new"), map[string]string{"owner": "ops"})
+	fake.put("dr", "dst/same.txt", []byte("same"), nil)
+	fake.put("dr", "dst/changed.txt", []byte("dcba"), nil)
+	fake.put("dr", "dst/extra.txt", []byte("extra"), nil)
+
+	opts := &SyncOptions{Extraneous: HideExtraneous, DryRun: true}
+	expected := []PlanAction{
+		{Op: PlanCopy, Name: "dst/changed.txt", Size: 4, Reason: "sha1 differs"},
+		{Op: PlanHide, Name: "dst/extra.txt", Size: 5, Reason: "not in source"},
+		{Op: PlanCopy, Name: "dst/new.txt", Size: 3, Reason: "new file"},
+	}
+	report, err := bucket.SyncToBucket("src/", dest, "dst/", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	testCheckSyncActions(t, report, expected)
+
+	opts.DryRun = false
+	report, err = bucket.SyncToBucket("src/", dest, "dst/", opts)
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	testCheckSyncActions(t, report, expected)
+	checkNames(t, fake.names("dr"), []string{"dst/changed.txt", "dst/new.txt", "dst/same.txt"})
+	for _, r := range fake.requests {
+		if r.URL.Path == "/upload/dr" {
+			t.Error("Expected a same account sync to copy server-side")
+		}
+	}
+
+	report, err = bucket.SyncToBucket("src/", dest, "dst/", opts)
+	if err != nil || len(report.Actions) != 0 || report.Unchanged != 3 {
+		t.Errorf("Expected nothing to sync, instead got %+v with %v", report, err)
+	}
+
+	if _, err := bucket.SyncToBucket("src/", bucket, "src/sub/", nil); err == nil {
+		t.Error("Expected overlapping prefixes in the same bucket to fail")
+	}
+}
+
+func TestBucket_SyncToBucket_largeFiles(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	dest := testBucket()
+	dest.ID = "dr"
+	dest.B2.client = fake
+
+	fake.put("id", "src/big", []byte("big"), nil)
+	fake.put("id", "src/big-dated", []byte("big"), map[string]string{"src_last_modified_millis": "1"})
+	for _, v := range fake.versions {
+		v.meta.ContentSha1 = "none"
+	}
+
+	opts := &SyncOptions{}
+	if _, err := bucket.SyncToBucket("src/", dest, "dst/", opts); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	report, err := bucket.SyncToBucket("src/", dest, "dst/", opts)
+	if err != nil || len(report.Actions) != 0 || report.Unchanged != 2 {
+		t.Errorf("Expected large files not to be copied again, instead got %+v with %v", report, err)
+	}
+}
+
+func TestRemoteDiffers(t *testing.T) {
+	dated := func(millis string) map[string]string {
+		return map[string]string{"src_last_modified_millis": millis}
+	}
+	cases := []struct {
+		src, dst FileMeta
+		reason   string
+	}{
+		{FileMeta{ContentLength: 1, ContentSha1: "a"}, FileMeta{ContentLength: 2, ContentSha1: "a"}, "size differs"},
+		{FileMeta{ContentSha1: "a"}, FileMeta{ContentSha1: "b"}, "sha1 differs"},
+		{FileMeta{ContentSha1: "a", UploadTimestamp: 2}, FileMeta{ContentSha1: "a", UploadTimestamp: 1}, ""},
+		{
+			FileMeta{ContentSha1: "none", FileInfo: map[string]string{"large_file_sha1": "a"}},
+			FileMeta{ContentSha1: "none", FileInfo: map[string]string{"large_file_sha1": "b"}},
+			"sha1 differs",
+		},
+		{FileMeta{ContentSha1: "none", FileInfo: dated("1")}, FileMeta{ContentSha1: "none", FileInfo: dated("2")}, "modified time differs"},
+		{FileMeta{ContentSha1: "none", FileInfo: dated("1"), UploadTimestamp: 2}, FileMeta{ContentSha1: "none", FileInfo: dated("1"), UploadTimestamp: 1}, ""},
+		{FileMeta{ContentSha1: "none", UploadTimestamp: 1}, FileMeta{ContentSha1: "none", UploadTimestamp: 2}, ""},
+		{FileMeta{ContentSha1: "none", UploadTimestamp: 2}, FileMeta{ContentSha1: "none", UploadTimestamp: 1}, "source is newer"},
+	}
+	for i, c := range cases {
+		if reason := remoteDiffers(c.src, c.dst); reason != c.reason {
+			t.Errorf("Expected %q, instead got %q, case %d", c.reason, reason, i)
+		}
+	}
+}
+
+func TestBucket_SyncToBucket_crossAccount(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	dest, destFake := testFakeBucket()
+	dest.ID = "dr"
+	dest.B2.AccountID = "other"
+
+	fake.put("id", "big.bin", testPlaintext(50), map[string]string{"src_last_modified_millis": "1500000000000"})
+	fake.put("id", "small.txt", []byte("small"), nil)
+
+	report, err := bucket.SyncToBucket("", dest, "", &SyncOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(report.Actions) != 2 {
+		t.Fatalf("Expected 2 copies, instead got %+v", report.Actions)
+	}
+	data, _ := destFake.data("dr", "big.bin")
+	if !bytes.Equal(data, testPlaintext(50)) {
+		t.Errorf("Expected big.bin to be streamed, instead got %q", data)
+	}
+	fm, _ := dest.currentFile("big.bin")
+	if fm.FileInfo["src_last_modified_millis"] != "1500000000000" {
+		t.Errorf("Expected the file info to be kept, instead got %+v", fm.FileInfo)
+	}
+	for _, r := range fake.requests {
+		if strings.HasSuffix(r.URL.Path, "b2_copy_file") {
+			t.Error("Expected a cross account sync not to copy server-side")
+		}
+	}
+}
+
+func TestBucket_SyncToBucket_crossAccountMismatch(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	dest, destFake := testFakeBucket()
+	dest.ID = "dr"
+	dest.B2.AccountID = "other"
+
+	fake.put("id", "a.txt", []byte("a"), nil)
+	fake.versions[0].meta.ContentSha1 = "bad"
+
+	if _, err := bucket.SyncToBucket("", dest, "", &SyncOptions{}); err == nil {
+		t.Fatal("Expected an error for a copy that doesn't match its source's sha1")
+	}
+	if names := destFake.names("dr"); len(names) != 0 {
+		t.Errorf("Expected the bad copy to be removed, instead got %v", names)
+	}
+}
+
+func TestSyncOptions_matches(t *testing.T) {
+	opts := &SyncOptions{Include: []string{"*.txt", "docs/*"}, Exclude: []string{"secret*"}}
+	cases := map[string]bool{
+		"a.txt":          true,
+		"dir/a.txt":      true,
+		"docs/readme.md": true,
+		"a.md":           false,
+		"secret.txt":     false,
+		"dir/secret.txt": false,
+	}
+	for name, expected := range cases {
+		if opts.matches(name) != expected {
+			t.Errorf("Expected %s to match %t", name, expected)
+		}
+	}
+}
+
+func testCheckSyncActions(t *testing.T, report *Plan, expected []PlanAction) {
+	t.Helper()
+	if len(report.Actions) != len(expected) {
+		t.Fatalf("Expected %d actions, instead got %+v", len(expected), report.Actions)
+	}
+	for i, a := range report.Actions {
+		e := expected[i]
+		if a.Op != e.Op || a.Name != e.Name || a.Size != e.Size || a.Reason != e.Reason || a.Err != nil {
+			t.Errorf("Expected action %+v, instead got %+v", e, a)
+		}
+	}
+}
+
+func testWriteFile(t *testing.T, dir, name, data string, modTime time.Time) {
+	t.Helper()
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkNames(t *testing.T, names, expected []string) {
+	t.Helper()
+	if len(names) != len(expected) {
+		t.Fatalf("Expected %v, instead got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Errorf("Expected %v, instead got %v", expected, names)
+			return
+		}
+	}
+}
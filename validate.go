@@ -0,0 +1,164 @@
+package b2
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The limits B2 places on file names and file info.
+const (
+	MaxFileNameBytes     = 1024
+	MaxFileNameSegment   = 250
+	MaxFileInfoKeys      = 10
+	MaxFileInfoKeyLength = 50
+
+	// MaxUploadHeaderBytes is the most the X-Bz-File-Name and X-Bz-Info-*
+	// headers of an upload may add up to, counting header names and values.
+	MaxUploadHeaderBytes = 7000
+)
+
+// b2InfoKeys are the file info keys starting with "b2-" that B2 allows,
+// which are sent as headers when the file is downloaded.
+var b2InfoKeys = map[string]bool{
+	"b2-content-disposition": true,
+	"b2-content-language":    true,
+	"b2-expires":             true,
+	"b2-cache-control":       true,
+	"b2-content-encoding":    true,
+}
+
+// ValidationError is returned when a file name or file info would be
+// rejected by B2. It is returned before any request is made.
+type ValidationError struct {
+	Field   string // what was invalid, such as "file name" or "file info key"
+	Value   string // the invalid name or key, if there is one
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// newValidationError returns a ValidationError for a value, giving the
+// reason.
+func newValidationError(field, value, format string, a ...interface{}) error {
+	return &ValidationError{
+		Field:   field,
+		Value:   value,
+		Message: fmt.Sprintf("Invalid %s %q: %s", field, value, fmt.Sprintf(format, a...)),
+	}
+}
+
+// ValidateFileName checks a file name against B2's rules.
+//
+// Names must be valid UTF-8 of at most MaxFileNameBytes, and may not contain
+// control characters. They may not start or end with "/" or contain "//",
+// and each "/" separated segment may be at most MaxFileNameSegment bytes.
+func ValidateFileName(name string) error {
+	invalid := func(format string, a ...interface{}) error {
+		return newValidationError("file name", name, format, a...)
+	}
+	if name == "" {
+		return invalid("name is empty")
+	}
+	if !utf8.ValidString(name) {
+		return invalid("not valid UTF-8")
+	}
+	if len(name) > MaxFileNameBytes {
+		return invalid("%d bytes is longer than %d", len(name), MaxFileNameBytes)
+	}
+	for _, r := range name {
+		if r < 32 || r == 127 {
+			return invalid("contains control character %U", r)
+		}
+	}
+	if strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return invalid("starts or ends with /")
+	}
+	if strings.Contains(name, "//") {
+		return invalid("contains //")
+	}
+	for _, s := range strings.Split(name, "/") {
+		if len(s) > MaxFileNameSegment {
+			return invalid("segment of %d bytes is longer than %d", len(s), MaxFileNameSegment)
+		}
+	}
+	return nil
+}
+
+// ValidateFileInfo checks file info against B2's rules.
+//
+// There may be at most MaxFileInfoKeys keys. Keys may be at most
+// MaxFileInfoKeyLength letters, digits, "-" and "_", and keys are
+// case-insensitive, so two keys may not differ only by case. Keys starting
+// with "b2-" are reserved for the download headers of UploadOptions, and
+// b2-expires must be an HTTP date. Values must be valid UTF-8.
+func ValidateFileInfo(info map[string]string) error {
+	if len(info) > MaxFileInfoKeys {
+		return &ValidationError{Field: "file info", Message: fmt.Sprintf("More than %d file info keys provided", MaxFileInfoKeys)}
+	}
+	// keys are checked in order, so the same info always gives the same
+	// error
+	keys := []string{}
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	seen := map[string]bool{}
+	for _, k := range keys {
+		v := info[k]
+		invalid := func(format string, a ...interface{}) error {
+			return newValidationError("file info key", k, format, a...)
+		}
+		if k == "" {
+			return invalid("key is empty")
+		}
+		if len(k) > MaxFileInfoKeyLength {
+			return invalid("longer than %d characters", MaxFileInfoKeyLength)
+		}
+		for _, r := range k {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return invalid("contains %q, only letters, digits, - and _ are allowed", r)
+			}
+		}
+		lower := strings.ToLower(k)
+		if seen[lower] {
+			return invalid("differs from another key only by case")
+		}
+		seen[lower] = true
+		if strings.HasPrefix(lower, "b2-") && !b2InfoKeys[lower] {
+			return invalid("keys starting with b2- are reserved")
+		}
+		if lower == "b2-expires" {
+			if _, err := http.ParseTime(v); err != nil {
+				return invalid("value %q is not an HTTP date", v)
+			}
+		}
+		if !utf8.ValidString(v) {
+			return invalid("value is not valid UTF-8")
+		}
+	}
+	return nil
+}
+
+// validateUploadHeaders checks the name and file info of an upload, and
+// that their headers fit within MaxUploadHeaderBytes.
+func validateUploadHeaders(name string, info map[string]string) error {
+	if err := ValidateFileName(name); err != nil {
+		return err
+	}
+	if err := ValidateFileInfo(info); err != nil {
+		return err
+	}
+	size := len("X-Bz-File-Name") + len(PercentEncode(name))
+	for k, v := range info {
+		size += len("X-Bz-Info-") + len(PercentEncode(k)) + len(PercentEncode(v))
+	}
+	if size > MaxUploadHeaderBytes {
+		return &ValidationError{Field: "file info", Message: fmt.Sprintf("File name and info headers are %d bytes, more than %d", size, MaxUploadHeaderBytes)}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package b2
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateFileName(t *testing.T) {
+	cases := []struct {
+		name    string
+		success bool
+	}{
+		{name: "kitten.jpg", success: true},
+		{name: "photos/2017/kitten.jpg", success: true},
+		{name: "ünïcödé/猫.jpg", success: true},
+		{name: `back\slash`, success: true},
+		{name: strings.Repeat("a", 250) + "/" + strings.Repeat("b", 250), success: true},
+		{name: "", success: false},
+		{name: "bad\xffutf8", success: false},
+		{name: "tab\there", success: false},
+		{name: "del\x7f", success: false},
+		{name: "/leading", success: false},
+		{name: "trailing/", success: false},
+		{name: "double//slash", success: false},
+		{name: strings.Repeat("a", 251), success: false},
+		{name: strings.Repeat("abcd/", 205), success: false},
+	}
+	for i, c := range cases {
+		err := ValidateFileName(c.name)
+		if (err == nil) != c.success {
+			t.Errorf("Expected success to be %t, instead got %v, case %d", c.success, err, i)
+		}
+		if err != nil {
+			if ve, ok := err.(*ValidationError); !ok || ve.Field != "file name" || ve.Value != c.name {
+				t.Errorf("Expected a file name ValidationError, instead got %#v, case %d", err, i)
+			}
+		}
+	}
+}
+
+func TestValidateFileInfo(t *testing.T) {
+	eleven := map[string]string{}
+	for i := 0; i < 11; i++ {
+		eleven[fmt.Sprintf("k%d", i)] = ""
+	}
+	cases := []struct {
+		info    map[string]string
+		success bool
+	}{
+		{info: nil, success: true},
+		{info: map[string]string{"src_last_modified_millis": "1", "Author-Name": "ünïcödé"}, success: true},
+		{info: map[string]string{"b2-cache-control": "no-cache", "b2-expires": "Thu, 01 Dec 1994 16:00:00 GMT"}, success: true},
+		{info: map[string]string{strings.Repeat("k", 50): ""}, success: true},
+		{info: eleven, success: false},
+		{info: map[string]string{"": "empty"}, success: false},
+		{info: map[string]string{strings.Repeat("k", 51): ""}, success: false},
+		{info: map[string]string{"has space": ""}, success: false},
+		{info: map[string]string{"dotted.key": ""}, success: false},
+		{info: map[string]string{"Owner": "a", "owner": "b"}, success: false},
+		{info: map[string]string{"b2-secret": ""}, success: false},
+		{info: map[string]string{"B2-Expires": "tomorrow"}, success: false},
+		{info: map[string]string{"key": "bad\xffutf8"}, success: false},
+	}
+	for i, c := range cases {
+		err := ValidateFileInfo(c.info)
+		if (err == nil) != c.success {
+			t.Errorf("Expected success to be %t, instead got %v, case %d", c.success, err, i)
+		}
+		if _, ok := err.(*ValidationError); err != nil && !ok {
+			t.Errorf("Expected a ValidationError, instead got %#v, case %d", err, i)
+		}
+	}
+}
+
+func TestValidateFileInfo_message(t *testing.T) {
+	err := ValidateFileInfo(map[string]string{"ok": "", "has space": ""})
+	expected := `Invalid file info key "has space": contains ' ', only letters, digits, - and _ are allowed`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected %s, instead got %v", expected, err)
+	}
+}
+
+func TestValidateUploadHeaders(t *testing.T) {
+	info := map[string]string{"a": strings.Repeat("v", 3000), "b": strings.Repeat("v", 3000)}
+	if err := validateUploadHeaders("name", info); err != nil {
+		t.Errorf("Expected headers within the limit to be valid, instead got %s", err)
+	}
+	info["c"] = strings.Repeat("v", 1000)
+	if err := validateUploadHeaders("name", info); err == nil {
+		t.Error("Expected headers over the limit to fail")
+	}
+	if err := validateUploadHeaders("bad//name", nil); err == nil {
+		t.Error("Expected an invalid name to fail")
+	}
+}
+
+func TestBucket_upload_validation(t *testing.T) {
+	bucket := testBucket()
+	bad := &UploadOptions{FileInfo: map[string]string{"b2-reserved": "x"}}
+
+	// validation errors are returned before any request is made
+	calls := []func() error{
+		func() error {
+			_, err := bucket.UploadFileWithOptions("dir//name", bytes.NewReader([]byte("cats")), nil)
+			return err
+		},
+		func() error {
+			_, err := bucket.UploadFileWithOptions("name", bytes.NewReader([]byte("cats")), bad)
+			return err
+		},
+		func() error {
+			_, err := bucket.StartLargeFile("name\n", nil)
+			return err
+		},
+		func() error {
+			_, err := bucket.CopyFile("id", "/copy", nil)
+			return err
+		},
+		func() error {
+			w := bucket.NewWriter("name", bad)
+			_, err := w.Write([]byte("cats"))
+			return err
+		},
+	}
+	for i, call := range calls {
+		if _, ok := call().(*ValidationError); !ok {
+			t.Errorf("Expected a ValidationError, case %d", i)
+		}
+	}
+	if req := bucket.B2.client.(*testClient).Request; req != nil {
+		t.Errorf("Expected no request to be made, instead got %s", req.URL)
+	}
+}
@@ -0,0 +1,185 @@
+package b2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+)
+
+// DefaultPartSize is the part size of a Writer, as recommended by B2.
+const DefaultPartSize = 100 * 1000 * 1000
+
+// Writer is an io.WriteCloser that uploads a file as it is written.
+//
+// Data is buffered until it's larger than PartSize, at which point a large
+// file is started and each full part is uploaded. Smaller files are uploaded
+// as a single file by Close.
+//
+// B2 only accepts a large file's large_file_sha1 when the file is started,
+// before its data has been written, so a Writer can't set it. If the sha1 is
+// known it can be given as large_file_sha1 in the FileInfo, and Close checks
+// it against the written data before finishing the file.
+type Writer struct {
+	// PartSize is the size of each part of a large file. B2 rejects parts
+	// smaller than MinPartSize, other than the last, so the first Write
+	// fails if it is smaller. It should only be changed before the first
+	// Write.
+	PartSize int
+
+	bucket  *Bucket
+	name    string
+	opts    *UploadOptions
+	buf     []byte
+	fileID  string
+	partURL *UploadPartURL
+	sha1s   []string
+	hash    hash.Hash
+	meta    *FileMeta
+	err     error
+	closed  bool
+}
+
+// NewWriter returns a Writer uploading a file with the given options.
+// Nothing is uploaded until the file is larger than the Writer's PartSize or
+// the Writer is closed.
+//
+// Compression isn't supported.
+func (b *Bucket) NewWriter(name string, opts *UploadOptions) *Writer {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	w := &Writer{
+		PartSize: DefaultPartSize,
+		bucket:   b,
+		name:     name,
+		opts:     opts,
+		hash:     sha1.New(),
+	}
+	if name == "" {
+		w.err = fmt.Errorf("No file name provided")
+	} else if opts.Compression != nil {
+		w.err = fmt.Errorf("Compression isn't supported by Writer")
+	} else {
+		w.err = opts.validate(name)
+	}
+	return w
+}
+
+// Write buffers p, uploading each full part once the file is large.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("Writer is closed")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.PartSize < MinPartSize {
+		w.err = fmt.Errorf("PartSize %d is smaller than the minimum of %d", w.PartSize, MinPartSize)
+		return 0, w.err
+	}
+	w.hash.Write(p)
+	w.buf = append(w.buf, p...)
+	for len(w.buf) > w.PartSize {
+		if err := w.uploadPart(w.buf[:w.PartSize]); err != nil {
+			return 0, err
+		}
+		w.buf = append([]byte{}, w.buf[w.PartSize:]...)
+	}
+	return len(p), nil
+}
+
+// Close uploads the rest of the file, returning an error if any part of the
+// upload failed. The uploaded file's FileMeta is then available from Meta.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.fileID == "" {
+		w.meta, w.err = w.bucket.UploadFileWithOptions(w.name, bytes.NewReader(w.buf), w.opts)
+		w.buf = nil
+		return w.err
+	}
+
+	if err := w.uploadPart(w.buf); err != nil {
+		return err
+	}
+	w.buf = nil
+	if want := w.opts.FileInfo["large_file_sha1"]; want != "" && want != fmt.Sprintf("%x", w.hash.Sum(nil)) {
+		return w.fail(fmt.Errorf("Written data didn't match large_file_sha1 %s", want))
+	}
+	w.meta, w.err = w.bucket.FinishLargeFile(w.fileID, w.sha1s)
+	if w.err != nil {
+		w.bucket.CancelLargeFile(w.fileID)
+	}
+	return w.err
+}
+
+// Abort stops the upload, canceling the large file if one was started.
+// Close returns an error after Abort.
+func (w *Writer) Abort() error {
+	if w.closed {
+		return fmt.Errorf("Writer is closed")
+	}
+	w.closed = true
+	w.buf = nil
+	if w.err == nil {
+		w.err = fmt.Errorf("Writer was aborted")
+	}
+	if w.fileID == "" {
+		return nil
+	}
+	return w.bucket.CancelLargeFile(w.fileID)
+}
+
+// Meta returns the FileMeta of the uploaded file, or nil if Close hasn't
+// succeeded. The ContentSha1 of a file uploaded in parts is "none", and it
+// only has a large_file_sha1 if one was given in the FileInfo.
+func (w *Writer) Meta() *FileMeta {
+	return w.meta
+}
+
+// uploadPart uploads the next part, starting the large file first if
+// needed. On failure the large file is canceled.
+func (w *Writer) uploadPart(data []byte) error {
+	if w.fileID == "" {
+		fm, err := w.bucket.StartLargeFile(w.name, w.opts)
+		if err != nil {
+			w.err = err
+			return err
+		}
+		w.fileID = fm.ID
+	}
+
+	part := len(w.sha1s) + 1
+	if part > MaxParts {
+		return w.fail(fmt.Errorf("More than %d parts written", MaxParts))
+	}
+	if w.partURL == nil {
+		u, err := w.bucket.GetUploadPartURL(w.fileID)
+		if err != nil {
+			return w.fail(err)
+		}
+		w.partURL = u
+	}
+
+	p, err := w.bucket.UploadPart(w.partURL, part, data, w.opts.Encryption)
+	if err != nil {
+		return w.fail(err)
+	}
+	w.sha1s = append(w.sha1s, p.ContentSha1)
+	return nil
+}
+
+// fail records err and cancels the large file.
+func (w *Writer) fail(err error) error {
+	w.err = err
+	w.bucket.CancelLargeFile(w.fileID)
+	w.fileID = ""
+	return err
+}
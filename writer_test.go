@@ -0,0 +1,176 @@
+package b2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"testing"
+)
+
+func TestWriter_small(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	w := bucket.NewWriter("small", &UploadOptions{FileInfo: map[string]string{"a": "b"}})
+	w.Write([]byte("all "))
+	w.Write([]byte("cats"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if w.Meta() == nil || w.Meta().Name != "small" || w.Meta().ContentSha1 == "none" {
+		t.Errorf("Expected a single file upload, instead got %+v", w.Meta())
+	}
+	if data, _ := fake.data("id", "small"); string(data) != "all cats" {
+		t.Errorf("Expected all cats, instead got %q", data)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Expected closing twice to succeed, instead got %s", err)
+	}
+	if _, err := w.Write([]byte("more")); err == nil {
+		t.Error("Expected writing after Close to fail")
+	}
+}
+
+func TestWriter_large(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	enc, _ := SSEC(testSSECKey())
+	w := bucket.NewWriter("large", &UploadOptions{Encryption: enc, FileInfo: map[string]string{"a": "b"}})
+	w.PartSize = MinPartSize
+
+	plain := testPlaintext(3*MinPartSize + 5)
+	for i := 0; i < len(plain); i += 999999 {
+		end := i + 999999
+		if end > len(plain) {
+			end = len(plain)
+		}
+		if n, err := w.Write(plain[i:end]); err != nil || n != end-i {
+			t.Fatalf("Expected to write %d bytes, instead wrote %d with %v", end-i, n, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+
+	if w.Meta() == nil || w.Meta().ContentSha1 != "none" || w.Meta().FileInfo["a"] != "b" {
+		t.Errorf("Expected a large file, instead got %+v", w.Meta())
+	}
+	if data, _ := fake.data("id", "large"); !bytes.Equal(data, plain) {
+		t.Errorf("Expected %q, instead got %q", plain, data)
+	}
+	parts := 0
+	for _, r := range fake.requests {
+		if r.Header.Get("X-Bz-Part-Number") == "" {
+			continue
+		}
+		parts++
+		if r.Header.Get("X-Bz-Server-Side-Encryption-Customer-Key") != enc.CustomerKey {
+			t.Errorf("Expected part %s to have the customer key", r.Header.Get("X-Bz-Part-Number"))
+		}
+	}
+	if parts != 4 {
+		t.Errorf("Expected 4 parts, instead got %d", parts)
+	}
+}
+
+func TestWriter_Abort(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	w := bucket.NewWriter("large", nil)
+	w.PartSize = MinPartSize
+	w.Write(testPlaintext(MinPartSize + 1))
+	if len(fake.large) != 1 {
+		t.Fatalf("Expected a started large file, instead got %d", len(fake.large))
+	}
+	if err := w.Abort(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if len(fake.large) != 0 {
+		t.Errorf("Expected the large file to be canceled")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Expected Close after Abort to fail")
+	}
+	if names := fake.names("id"); len(names) != 0 {
+		t.Errorf("Expected no files, instead got %v", names)
+	}
+}
+
+func TestWriter_partFailure(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	w := bucket.NewWriter("large", nil)
+	w.PartSize = MinPartSize
+	w.Write(testPlaintext(MinPartSize + 5))
+	// the part URL now points at a file that doesn't exist
+	w.partURL.URL = "https://fake/upload_part/missing"
+	if _, err := w.Write(testPlaintext(MinPartSize)); err == nil {
+		t.Fatal("Expected the part upload to fail")
+	}
+	if len(fake.large) != 0 {
+		t.Errorf("Expected the large file to be canceled")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Expected Close to return the part error")
+	}
+}
+
+func TestWriter_smallPartSize(t *testing.T) {
+	bucket, fake := testFakeBucket()
+	w := bucket.NewWriter("large", nil)
+	w.PartSize = 10
+	if _, err := w.Write(testPlaintext(25)); err == nil {
+		t.Error("Expected a PartSize smaller than MinPartSize to fail")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Expected Close to return the PartSize error")
+	}
+	if len(fake.requests) != 0 {
+		t.Errorf("Expected no requests, instead got %d", len(fake.requests))
+	}
+}
+
+func TestWriter_largeFileSha1(t *testing.T) {
+	plain := testPlaintext(MinPartSize + 5)
+	sum := fmt.Sprintf("%x", sha1.Sum(plain))
+
+	bucket, fake := testFakeBucket()
+	w := bucket.NewWriter("large", &UploadOptions{FileInfo: map[string]string{"large_file_sha1": sum}})
+	w.PartSize = MinPartSize
+	w.Write(plain)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected no error, instead got %s", err)
+	}
+	if fileSha1(w.Meta()) != sum {
+		t.Errorf("Expected large_file_sha1 %s, instead got %+v", sum, w.Meta())
+	}
+
+	w = bucket.NewWriter("wrong", &UploadOptions{FileInfo: map[string]string{"large_file_sha1": "wrong"}})
+	w.PartSize = MinPartSize
+	w.Write(plain)
+	if err := w.Close(); err == nil {
+		t.Error("Expected a mismatched large_file_sha1 to fail")
+	}
+	if len(fake.large) != 0 {
+		t.Errorf("Expected the large file to be canceled")
+	}
+	if _, ok := fake.data("id", "wrong"); ok {
+		t.Error("Expected the mismatched file not to be finished")
+	}
+}
+
+func TestBucket_NewWriter(t *testing.T) {
+	bucket := testBucket()
+	cases := []struct {
+		name string
+		opts *UploadOptions
+	}{
+		{name: "", opts: nil},
+		{name: "name", opts: &UploadOptions{Compression: Gzip}},
+		{name: "name", opts: &UploadOptions{LegalHold: "maybe"}},
+	}
+	for i, c := range cases {
+		w := bucket.NewWriter(c.name, c.opts)
+		if _, err := w.Write([]byte("cats")); err == nil {
+			t.Errorf("Expected Write to fail, case %d", i)
+		}
+		if err := w.Close(); err == nil {
+			t.Errorf("Expected Close to fail, case %d", i)
+		}
+	}
+}